@@ -17,10 +17,12 @@ limitations under the License.
 package v1
 
 import (
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // S3BucketSpec defines the desired state of S3Bucket
+// +kubebuilder:validation:XValidation:rule="has(self.iamRole) && has(self.iamRole.arn) ? has(oldSelf.iamRole) && has(oldSelf.iamRole.arn) && self.iamRole.arn == oldSelf.iamRole.arn : !(has(oldSelf.iamRole) && has(oldSelf.iamRole.arn))",message="iamRole.arn is immutable"
 type S3BucketSpec struct {
 	// +kubebuilder:validation:MinLength:=3
 	// +kubebuilder:validation:MaxLength:=63
@@ -33,19 +35,414 @@ type S3BucketSpec struct {
 	// +optional
 	Tags map[string]string `json:"tags,omitempty"`
 
+	// IamRole of the bucket, a role is created by the operator when not set
+	// +optional
+	IamRole *IamRoleSpec `json:"iamRole,omitempty"`
+
+	// Access that the iam role of the bucket gets, read-write on the whole bucket when not set
+	// +optional
+	Access *BucketAccess `json:"access,omitempty"`
+
+	// Encryption with AES256 when true. deprecated, encryptionSettings is used instead when it is set
 	// +optional
 	// +kubebuilder:default:=false
 	Encryption bool `json:"encryption,omitempty"`
+
+	// EncryptionSettings of the bucket objects, default encryption of aws is used when neither it nor encryption is set
+	// +optional
+	EncryptionSettings *BucketEncryption `json:"encryptionSettings,omitempty"`
+
+	// Versioning state of the bucket, versioning is not managed when not set
+	// +optional
+	// +kubebuilder:validation:Enum=Enabled;Suspended
+	Versioning string `json:"versioning,omitempty"`
+
+	// LifecycleRules of the bucket, the lifecycle configuration is not managed when not set.
+	// the rules that the operator applied are removed when they are removed from the spec
+	// +optional
+	// +listType=map
+	// +listMapKey=id
+	LifecycleRules []LifecycleRule `json:"lifecycleRules,omitempty"`
+
+	// Cors rules of the bucket, the cors configuration is not managed when not set.
+	// the rules that the operator applied are removed when they are removed from the spec
+	// +optional
+	Cors []CORSRule `json:"cors,omitempty"`
+
+	// PublicAccess relaxes the public access block of the bucket, all the flags are enabled when not set
+	// +optional
+	PublicAccess *PublicAccessBlock `json:"publicAccess,omitempty"`
+
+	// DeletionPolicy of the aws resources when the S3Bucket is deleted,
+	// the operator default is used when not set
+	// +optional
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+}
+
+// GetEncryption returns the encryption of the bucket, the deprecated encryption flag is AES256.
+// nil is returned when the spec does not request encryption
+func (in *S3BucketSpec) GetEncryption() *BucketEncryption {
+	if in.EncryptionSettings != nil {
+		return in.EncryptionSettings
+	}
+	if in.Encryption {
+		return &BucketEncryption{Algorithm: "AES256"}
+	}
+	return nil
+}
+
+// IamRoleSpec selects an existing role for the bucket or extends the role that the operator creates
+type IamRoleSpec struct {
+	// Arn of an existing role to use instead of creating one. the operator only puts the bucket inline policy
+	// on it and never deletes it, its trust policy is not managed. it cant be set, changed or removed after
+	// the bucket was created
+	// +optional
+	// +kubebuilder:validation:Pattern:=`^arn:aws[a-z-]*:iam::[0-9]{12}:role/.+$`
+	Arn string `json:"arn,omitempty"`
+
+	// ManagedPolicyArns that are attached to the role that the operator creates, cant be used with arn
+	// +optional
+	ManagedPolicyArns []string `json:"managedPolicyArns,omitempty"`
+}
+
+// BucketAccess is the access of the bucket role to the bucket, limited to the given key prefixes
+type BucketAccess struct {
+	// +optional
+	// +kubebuilder:default:=read-write
+	Level AccessLevel `json:"level,omitempty"`
+
+	// Actions that the role is allowed to do on the bucket and its objects, required with the custom level
+	// +optional
+	Actions []string `json:"actions,omitempty"`
+
+	// Prefixes of the object keys that the role can access, the whole bucket when empty
+	// +optional
+	Prefixes []string `json:"prefixes,omitempty"`
+}
+
+// AccessLevel is a predefined set of s3 actions that the bucket role gets
+// +kubebuilder:validation:Enum=read-only;read-write;write-only;custom
+type AccessLevel string
+
+const (
+	AccessLevelReadOnly  AccessLevel = "read-only"
+	AccessLevelReadWrite AccessLevel = "read-write"
+	AccessLevelWriteOnly AccessLevel = "write-only"
+	// AccessLevelCustom allows only the actions listed in the access
+	AccessLevelCustom AccessLevel = "custom"
+)
+
+// BucketEncryption is the default server side encryption of the bucket
+type BucketEncryption struct {
+	// +optional
+	// +kubebuilder:default:=AES256
+	// +kubebuilder:validation:Enum=AES256;"aws:kms";"aws:kms:dsse"
+	Algorithm string `json:"algorithm,omitempty"`
+
+	// KmsKeyId is the arn, id or alias of a customer managed kms key, used only with the aws:kms algorithms.
+	// the aws managed key is used when not set
+	// +optional
+	KmsKeyId string `json:"kmsKeyId,omitempty"`
+
+	// BucketKey reduces the requests to kms, enabled by default except for aws:kms:dsse that doesnt support it
+	// +optional
+	BucketKey *bool `json:"bucketKey,omitempty"`
+}
+
+// LifecycleRule defines expiration and transition of the bucket objects that match the prefix and tags filter
+type LifecycleRule struct {
+	// +kubebuilder:validation:MinLength:=1
+	// +kubebuilder:validation:MaxLength:=255
+	ID string `json:"id"`
+
+	// +optional
+	// +kubebuilder:default:=true
+	Enabled *bool `json:"enabled,omitempty"`
+
+	// +optional
+	Prefix string `json:"prefix,omitempty"`
+
+	// Tags that the objects must have, all of them
+	// +optional
+	Tags map[string]string `json:"tags,omitempty"`
+
+	// +optional
+	// +kubebuilder:validation:Minimum:=1
+	ExpirationDays *int64 `json:"expirationDays,omitempty"`
+
+	// +optional
+	// +kubebuilder:validation:Minimum:=1
+	NoncurrentVersionExpirationDays *int64 `json:"noncurrentVersionExpirationDays,omitempty"`
+
+	// +optional
+	Transitions []LifecycleTransition `json:"transitions,omitempty"`
+
+	// +optional
+	// +kubebuilder:validation:Minimum:=1
+	AbortIncompleteMultipartUploadDays *int64 `json:"abortIncompleteMultipartUploadDays,omitempty"`
 }
 
+// LifecycleTransition moves the objects to another storage class after the given days
+type LifecycleTransition struct {
+	// +kubebuilder:validation:Minimum:=0
+	Days int64 `json:"days"`
+
+	// +kubebuilder:validation:Enum=GLACIER;STANDARD_IA;ONEZONE_IA;INTELLIGENT_TIERING;DEEP_ARCHIVE;GLACIER_IR
+	StorageClass string `json:"storageClass"`
+}
+
+// CORSRule allows cross origin requests to the bucket, rules are evaluated in order
+type CORSRule struct {
+	// +optional
+	ID string `json:"id,omitempty"`
+
+	// +kubebuilder:validation:MinItems=1
+	AllowedOrigins []string `json:"allowedOrigins"`
+
+	// +kubebuilder:validation:MinItems=1
+	AllowedMethods []CORSMethod `json:"allowedMethods"`
+
+	// +optional
+	AllowedHeaders []string `json:"allowedHeaders,omitempty"`
+
+	// +optional
+	ExposedHeaders []string `json:"exposedHeaders,omitempty"`
+
+	// +optional
+	// +kubebuilder:validation:Minimum:=0
+	MaxAgeSeconds *int64 `json:"maxAgeSeconds,omitempty"`
+}
+
+// CORSMethod is an http method that allowed by a cors rule
+// +kubebuilder:validation:Enum=GET;PUT;POST;DELETE;HEAD
+type CORSMethod string
+
+// PublicAccessBlock flags of the bucket, every flag that is not set is enabled
+type PublicAccessBlock struct {
+	// +optional
+	BlockPublicAcls *bool `json:"blockPublicAcls,omitempty"`
+
+	// +optional
+	IgnorePublicAcls *bool `json:"ignorePublicAcls,omitempty"`
+
+	// +optional
+	BlockPublicPolicy *bool `json:"blockPublicPolicy,omitempty"`
+
+	// +optional
+	RestrictPublicBuckets *bool `json:"restrictPublicBuckets,omitempty"`
+}
+
+// DeletionPolicy describes what happens to the bucket and its iam role when the S3Bucket is deleted
+// +kubebuilder:validation:Enum=Delete;Retain;Orphan
+type DeletionPolicy string
+
+const (
+	// DeletionPolicyDelete deletes the bucket with all its content and the iam role
+	DeletionPolicyDelete DeletionPolicy = "Delete"
+	// DeletionPolicyRetain keeps the bucket and the iam role but removes the operator managed tag
+	DeletionPolicyRetain DeletionPolicy = "Retain"
+	// DeletionPolicyOrphan leaves the bucket and the iam role untouched
+	DeletionPolicyOrphan DeletionPolicy = "Orphan"
+)
+
+// DryRunAnnotation set to "true" makes the operator only plan the changes of the S3Bucket, the planned
+// changes are reported in the status and in an event and nothing is applied
+const DryRunAnnotation = "s3operator.payu.com/dry-run"
+
+// Condition types reported in S3BucketStatus, one for each step of the bucket provisioning
+const (
+	ConditionBucketCreated       = "BucketCreated"
+	ConditionTaggingApplied      = "TaggingApplied"
+	ConditionPolicyApplied       = "PolicyApplied"
+	ConditionEncryptionApplied   = "EncryptionApplied"
+	ConditionVersioningApplied   = "VersioningApplied"
+	ConditionLifecycleApplied    = "LifecycleApplied"
+	ConditionCorsApplied         = "CorsApplied"
+	ConditionPublicAccessApplied = "PublicAccessBlockApplied"
+	ConditionIAMRoleReady        = "IAMRoleReady"
+	ConditionIAMRoleDeleted      = "IAMRoleDeleted"
+	ConditionServiceAccountBound = "ServiceAccountBound"
+	ConditionAuthServerApproved  = "AuthServerApproved"
+)
+
+// ConditionReady summarizes the last reconcile of the bucket, when it failed the reason is the kind of the failure
+const ConditionReady = "Ready"
+
+// ConditionPlanned is the result of the last dry-run reconcile, it is removed when the bucket leaves dry-run
+const ConditionPlanned = "Planned"
+
+// Condition reasons reported in S3BucketStatus
+const (
+	ReasonSucceeded    = "Succeeded"
+	ReasonFailed       = "Failed"
+	ReasonNotRequested = "NotRequested"
+	ReasonRolledBack   = "RolledBack"
+
+	// reasons of a failed Ready condition, throttled and transient failures are retried with backoff,
+	// the other failures are not retried until the spec changes
+	ReasonThrottled        = "Throttled"
+	ReasonTransientError   = "TransientError"
+	ReasonConflict         = "Conflict"
+	ReasonInvalidSpec      = "InvalidSpec"
+	ReasonPermissionDenied = "PermissionDenied"
+)
+
+// Event reasons emitted on S3Bucket
+const (
+	EventBucketCreated           = "BucketCreated"
+	EventCreationStepFailed      = "CreationStepFailed"
+	EventCreationRolledBack      = "CreationRolledBack"
+	EventTagsUpdated             = "TagsUpdated"
+	EventPolicyApplied           = "PolicyApplied"
+	EventRoleCreated             = "RoleCreated"
+	EventDriftCorrected          = "DriftCorrected"
+	EventServiceAccountCreated   = "ServiceAccountCreated"
+	EventServiceAccountAnnotated = "ServiceAccountAnnotated"
+	EventWorkloadMismatch        = "WorkloadMismatch"
+	EventAuthServerApproved      = "AuthServerApproved"
+	EventAuthServerRejected      = "AuthServerRejected"
+	EventDeletionBlocked         = "DeletionBlocked"
+	EventBucketDeleted           = "BucketDeleted"
+	EventDryRunPlanned           = "DryRunPlanned"
+)
+
 // S3BucketStatus defines the observed state of S3Bucket
 type S3BucketStatus struct {
 	// +kubebuilder:default:=failed
 	Status string `json:"status"`
+
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// +optional
+	LastSyncTime *metav1.Time `json:"lastSyncTime,omitempty"`
+
+	// +optional
+	LastError string `json:"lastError,omitempty"`
+
+	// +optional
+	BucketArn string `json:"bucketArn,omitempty"`
+
+	// +optional
+	Region string `json:"region,omitempty"`
+
+	// +optional
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// +optional
+	IamRoleArn string `json:"iamRoleArn,omitempty"`
+
+	// ProvisioningStep is the step of the bucket creation that did not finish yet, empty when the creation finished.
+	// the creation is resumed from this step on the next reconcile
+	// +optional
+	ProvisioningStep string `json:"provisioningStep,omitempty"`
+
+	// ProvisioningFailures counts the failures of the provisioning step, the creation is rolled back
+	// when it reaches the limit of the operator
+	// +optional
+	ProvisioningFailures int32 `json:"provisioningFailures,omitempty"`
+
+	// IamRoleName that was chosen for the bucket role, kept when the naming template of the operator changes
+	// +optional
+	IamRoleName string `json:"iamRoleName,omitempty"`
+
+	// ServiceAccount that the iam role is bound to, the binding is moved when spec.serviceaccount changes
+	// +optional
+	ServiceAccount string `json:"serviceAccount,omitempty"`
+
+	// Drift of the bucket settings that were changed outside of the operator and corrected by the resync
+	// +optional
+	// +listType=map
+	// +listMapKey=field
+	Drift []FieldDrift `json:"drift,omitempty"`
+
+	// PlannedChanges are the calls that the last dry-run reconcile skipped, empty when the bucket is in sync
+	// with its spec. the list is capped, the calls that did not fit are counted by a last change of the dry-run
+	// service. the rest of the status is not changed by a dry-run reconcile
+	// +optional
+	PlannedChanges []PlannedChange `json:"plannedChanges,omitempty"`
+
+	// +optional
+	LastPlanTime *metav1.Time `json:"lastPlanTime,omitempty"`
+
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// PlannedChange is a call to aws, kubernetes or the auth server that a dry-run reconcile did not make
+type PlannedChange struct {
+	// Service that the call is made to: s3, iam, kubernetes or auth-server, or dry-run for the summary of the
+	// calls that did not fit in the list
+	Service string `json:"service"`
+
+	// Operation of the service, e.g. PutBucketTagging, or the creation step of a bucket that does not exist yet
+	Operation string `json:"operation"`
+
+	// Details are the parameters of the call
+	// +optional
+	Details string `json:"details,omitempty"`
+}
+
+// FieldDrift is a setting of the bucket that was found different from the spec
+type FieldDrift struct {
+	Field string `json:"field"`
+
+	LastDetectedTime metav1.Time `json:"lastDetectedTime"`
+
+	// Count of the times that the drift was corrected
+	Count int32 `json:"count"`
+}
+
+// RecordDrift records that the field was found different from the spec and corrected
+func (in *S3BucketStatus) RecordDrift(field string, detectedTime metav1.Time) {
+	for i := range in.Drift {
+		if in.Drift[i].Field == field {
+			in.Drift[i].LastDetectedTime = detectedTime
+			in.Drift[i].Count++
+			return
+		}
+	}
+	in.Drift = append(in.Drift, FieldDrift{Field: field, LastDetectedTime: detectedTime, Count: 1})
+}
+
+// SetCondition records the result of a provisioning step, the condition is False with
+// the error message when err is not nil
+func (in *S3BucketStatus) SetCondition(conditionType string, generation int64, err error) {
+	condition := metav1.Condition{
+		Type:               conditionType,
+		Status:             metav1.ConditionTrue,
+		Reason:             ReasonSucceeded,
+		ObservedGeneration: generation,
+	}
+	if err != nil {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = ReasonFailed
+		condition.Message = err.Error()
+	}
+	meta.SetStatusCondition(&in.Conditions, condition)
+}
+
+// SetNotRequested records that the spec does not request the setting of the condition, so the setting is not managed
+func (in *S3BucketStatus) SetNotRequested(conditionType string, generation int64) {
+	meta.SetStatusCondition(&in.Conditions, metav1.Condition{Type: conditionType, Status: metav1.ConditionFalse,
+		Reason: ReasonNotRequested, ObservedGeneration: generation})
+}
+
+// IsSettingManaged is true when the operator applied the setting of the condition to the bucket, or tried to.
+// it is false for a setting that was never requested, which is left as it was configured outside of the operator
+func (in *S3BucketStatus) IsSettingManaged(conditionType string) bool {
+	condition := meta.FindStatusCondition(in.Conditions, conditionType)
+	return condition != nil && condition.Reason != ReasonNotRequested
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Status",type=string,JSONPath=`.status.status`
+//+kubebuilder:printcolumn:name="Role",type=string,JSONPath=`.status.iamRoleArn`,priority=1
+//+kubebuilder:printcolumn:name="Last-Error",type=string,JSONPath=`.status.lastError`,priority=1
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // S3Bucket is the Schema for the s3buckets API
 type S3Bucket struct {
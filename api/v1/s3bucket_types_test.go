@@ -0,0 +1,40 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestDecodeBooleanEncryption(t *testing.T) {
+	g := NewWithT(t)
+	// S3Buckets that were stored before the encryption settings have the boolean encryption, false by default
+	var s3Bucket S3Bucket
+	g.Expect(json.Unmarshal([]byte(`{"spec":{"serviceaccount":"app","encryption":false}}`), &s3Bucket)).To(Succeed())
+	g.Expect(s3Bucket.Spec.GetEncryption()).To(BeNil())
+
+	s3Bucket = S3Bucket{}
+	g.Expect(json.Unmarshal([]byte(`{"spec":{"serviceaccount":"app","encryption":true}}`), &s3Bucket)).To(Succeed())
+	g.Expect(s3Bucket.Spec.GetEncryption()).To(Equal(&BucketEncryption{Algorithm: "AES256"}))
+
+	s3Bucket = S3Bucket{}
+	g.Expect(json.Unmarshal([]byte(`{"spec":{"serviceaccount":"app","encryption":true,
+		"encryptionSettings":{"algorithm":"aws:kms","kmsKeyId":"alias/app"}}}`), &s3Bucket)).To(Succeed())
+	g.Expect(s3Bucket.Spec.GetEncryption()).To(Equal(&BucketEncryption{Algorithm: "aws:kms", KmsKeyId: "alias/app"}))
+}
+
+func TestIsSettingManaged(t *testing.T) {
+	g := NewWithT(t)
+	status := &S3BucketStatus{}
+	g.Expect(status.IsSettingManaged(ConditionLifecycleApplied)).To(BeFalse())
+
+	status.SetCondition(ConditionLifecycleApplied, 1, errors.New("malformed xml"))
+	g.Expect(status.IsSettingManaged(ConditionLifecycleApplied)).To(BeTrue())
+	status.SetCondition(ConditionLifecycleApplied, 1, nil)
+	g.Expect(status.IsSettingManaged(ConditionLifecycleApplied)).To(BeTrue())
+
+	status.SetNotRequested(ConditionLifecycleApplied, 2)
+	g.Expect(status.IsSettingManaged(ConditionLifecycleApplied)).To(BeFalse())
+}
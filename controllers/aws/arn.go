@@ -0,0 +1,77 @@
+package aws
+
+import (
+	"errors"
+	"fmt"
+
+	s3operatorv1 "github.com/PayU/K8s-S3-Operator/api/v1"
+	"github.com/PayU/K8s-S3-Operator/controllers/config"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/go-logr/logr"
+)
+
+// getAccountIdentity returns the partition and the account id of the operator, the configured values are used
+// when set, otherwise they are discovered with sts. the partition of the region is used when it cant be discovered.
+// an error is returned when the account id is unknown, the arns of the managed resources can not be built without it
+func getAccountIdentity(Log *logr.Logger, ses *session.Session) (string, string, error) {
+	partition, accountId := config.AwsPartition(), config.AwsAccountId()
+	if accountId == "" || partition == "" {
+		stsClient := sts.New(ses)
+		limitRequests(&stsClient.Handlers, sts.ServiceName)
+		res, err := stsClient.GetCallerIdentity(&sts.GetCallerIdentityInput{})
+		if err != nil {
+			Log.Error(err, "didnt succeded to discover aws account identity")
+			return "", "", fmt.Errorf("didnt succeded to discover aws account identity, set AWS_ACCOUNT_ID and AWS_PARTITION or allow sts:GetCallerIdentity: %w", err)
+		}
+		if accountId == "" {
+			accountId = aws.StringValue(res.Account)
+		}
+		if callerArn, err := arn.Parse(aws.StringValue(res.Arn)); err == nil && partition == "" {
+			partition = callerArn.Partition
+		}
+	}
+	if partition == "" {
+		partition = endpoints.AwsPartitionID
+		if regionPartition, found := endpoints.PartitionForRegion(endpoints.DefaultPartitions(), config.Region()); found {
+			partition = regionPartition.ID()
+		}
+	}
+	if accountId == "" {
+		return "", "", errors.New("aws account id is unknown, set AWS_ACCOUNT_ID or allow sts:GetCallerIdentity")
+	}
+	Log.Info("aws account identity", "partition", partition, "account_id", accountId)
+	return partition, accountId, nil
+}
+
+// buildArn returns the arn of a resource in the given partition, region and account are omitted when empty
+func buildArn(partition string, service string, region string, accountId string, resource string) string {
+	return arn.ARN{Partition: partition, Service: service, Region: region, AccountID: accountId, Resource: resource}.String()
+}
+
+// GetBucketArn returns the arn of the s3 bucket
+func (a *AwsClient) GetBucketArn(bucketName string) string {
+	return buildArn(a.partition, "s3", "", "", bucketName)
+}
+
+// GetRoleArn returns the arn of the iam role of the bucket, the arn from the status is used when the role was created
+func (a *AwsClient) GetRoleArn(s3Bucket *s3operatorv1.S3Bucket) (string, error) {
+	if isExistingRole(&s3Bucket.Spec) {
+		return s3Bucket.Spec.IamRole.Arn, nil
+	}
+	if s3Bucket.Status.IamRoleArn != "" {
+		return s3Bucket.Status.IamRoleArn, nil
+	}
+	roleName, err := a.GetRoleName(s3Bucket)
+	if err != nil {
+		return "", err
+	}
+	return buildArn(a.partition, "iam", "", a.accountId, "role"+config.RolePath()+roleName), nil
+}
+
+func (a *AwsClient) oidcProviderArn() string {
+	return buildArn(a.partition, "iam", "", a.accountId, "oidc-provider/"+a.oidcIssuer)
+}
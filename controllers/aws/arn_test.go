@@ -0,0 +1,69 @@
+package aws
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	s3operatorv1 "github.com/PayU/K8s-S3-Operator/api/v1"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/go-logr/logr"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestArnsOfPartitions(t *testing.T) {
+	g := NewWithT(t)
+	s3Bucket := &s3operatorv1.S3Bucket{ObjectMeta: metav1.ObjectMeta{Name: "bucket", Namespace: "team-a"}}
+	s3Bucket.Status.IamRoleName = "bucket-role"
+
+	awsClient := &AwsClient{partition: "aws", accountId: "111122223333", oidcIssuer: "oidc.eks.eu-central-1.amazonaws.com/id/EXAMPLE"}
+	g.Expect(awsClient.GetBucketArn("bucket")).To(Equal("arn:aws:s3:::bucket"))
+	g.Expect(awsClient.GetRoleArn(s3Bucket)).To(Equal("arn:aws:iam::111122223333:role/s3-operator/bucket-role"))
+	g.Expect(awsClient.oidcProviderArn()).To(Equal("arn:aws:iam::111122223333:oidc-provider/oidc.eks.eu-central-1.amazonaws.com/id/EXAMPLE"))
+
+	awsClient = &AwsClient{partition: "aws-cn", accountId: "111122223333"}
+	g.Expect(awsClient.GetBucketArn("bucket")).To(Equal("arn:aws-cn:s3:::bucket"))
+	g.Expect(awsClient.GetRoleArn(s3Bucket)).To(Equal("arn:aws-cn:iam::111122223333:role/s3-operator/bucket-role"))
+
+	awsClient = &AwsClient{partition: "aws-us-gov", accountId: "111122223333"}
+	g.Expect(awsClient.GetRoleArn(s3Bucket)).To(HavePrefix("arn:aws-us-gov:iam::111122223333:role/"))
+	g.Expect(buildArn("aws-us-gov", "kms", "us-gov-west-1", "*", "key/id")).To(Equal("arn:aws-us-gov:kms:us-gov-west-1:*:key/id"))
+
+	s3Bucket.Status.IamRoleArn = "arn:aws:iam::111122223333:role/existing"
+	g.Expect(awsClient.GetRoleArn(s3Bucket)).To(Equal(s3Bucket.Status.IamRoleArn))
+}
+
+func TestAccountIdentityIsRequired(t *testing.T) {
+	g := NewWithT(t)
+	logger := logr.Discard()
+	isDenied := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isDenied {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, "<ErrorResponse><Error><Code>AccessDenied</Code><Message>access denied</Message></Error></ErrorResponse>")
+			return
+		}
+		fmt.Fprint(w, "<GetCallerIdentityResponse><GetCallerIdentityResult><Arn>arn:aws-cn:iam::111122223333:user/operator</Arn>"+
+			"<Account>111122223333</Account></GetCallerIdentityResult></GetCallerIdentityResponse>")
+	}))
+	defer server.Close()
+	ses := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("eu-central-1"),
+		Endpoint:    aws.String(server.URL),
+		Credentials: credentials.AnonymousCredentials,
+		MaxRetries:  aws.Int(0),
+	}))
+
+	_, _, err := getAccountIdentity(&logger, ses)
+	g.Expect(err).To(MatchError(ContainSubstring("AWS_ACCOUNT_ID")))
+
+	isDenied = false
+	partition, accountId, err := getAccountIdentity(&logger, ses)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(partition).To(Equal("aws-cn"))
+	g.Expect(accountId).To(Equal("111122223333"))
+}
@@ -1,23 +1,39 @@
 package aws
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"github.com/PayU/K8s-S3-Operator/controllers/config"
+	"github.com/PayU/K8s-S3-Operator/controllers/dryrun"
+	"github.com/PayU/K8s-S3-Operator/controllers/metrics"
+	"github.com/PayU/K8s-S3-Operator/controllers/tracing"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/go-logr/logr"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/aws/aws-sdk-go/service/iam"
 	"github.com/aws/aws-sdk-go/service/s3"
 )
 
+// AwsClient holds no per-request state, so it is shared by concurrent reconciles.
+// its methods take the logger of the reconcile from the context
 type AwsClient struct {
 	s3Client  *s3.S3
-	Log       *logr.Logger
 	iamClient *IamClient
+	// Recorder emits the events of the aws lifecycle steps on the S3Bucket resource
+	Recorder record.EventRecorder
+	// k8sClient persists the progress of the bucket creation in the status of the S3Bucket
+	k8sClient client.Client
+	// oidcIssuer of the cluster that the bucket roles trust, without the scheme
+	oidcIssuer string
+	// partition and accountId of the operator, used to build the arns of the managed resources
+	partition string
+	accountId string
 }
 
 func CreateSession(Log *logr.Logger) *session.Session {
@@ -27,31 +43,90 @@ func CreateSession(Log *logr.Logger) *session.Session {
 		Endpoint:                      aws.String(config.AwsEndpoint()),
 		CredentialsChainVerboseErrors: aws.Bool(config.AwsCredentialsChainVerboseErrors()),
 		DisableSSL:                    aws.Bool(config.AwsConfigDisableSSL()),
+		Retryer:                       newThrottlingRetryer(),
 	}
 	awsConfig.HTTPClient = &http.Client{Timeout: config.Timeout()}
 	Log.Info("Create Session with aws config ", "Region", awsConfig.Region, "Endpoint", awsConfig.Endpoint)
 	ses := session.Must(session.NewSession(awsConfig))
+	ses.Handlers.Validate.PushFront(tracing.StartAwsRequest)
+	ses.Handlers.Validate.PushFront(setOperationDeadline)
+	// pushed back, so a dry-run reconcile still validates the parameters of the operations it skips
+	ses.Handlers.Validate.PushBack(dryrun.SkipAwsMutation)
+	ses.Handlers.Complete.PushBack(metrics.ObserveAwsRequest)
+	ses.Handlers.Complete.PushBack(tracing.EndAwsRequest)
+	ses.Handlers.Complete.PushBack(releaseOperationDeadline)
 
 	return ses
 }
 
-func setClients(Log *logr.Logger) (*s3.S3, *iam.IAM) {
-	ses := CreateSession(Log)
+type operationCancelKey struct{}
+
+// setOperationDeadline is a validate handler of the aws session, it bounds every api operation,
+// retries included, by the timeout of the operation in the config
+func setOperationDeadline(r *request.Request) {
+	operation := ""
+	if r.Operation != nil {
+		operation = r.Operation.Name
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), config.AwsOperationTimeout(operation))
+	r.SetContext(context.WithValue(ctx, operationCancelKey{}, cancel))
+}
+
+// releaseOperationDeadline is a complete handler of the aws session, it releases the deadline of the operation
+func releaseOperationDeadline(r *request.Request) {
+	if cancel, isFound := r.Context().Value(operationCancelKey{}).(context.CancelFunc); isFound {
+		cancel()
+	}
+}
+
+func setClients(Log *logr.Logger, ses *session.Session) (*s3.S3, *iam.IAM) {
 	if ses == nil {
 		err := errors.New("ses is nil")
 		Log.Error(err, "error in create new session")
 	} else {
 		Log.Info("session", "ses", ses)
-		return SetS3Client(Log, ses), setIamClient(Log, ses)
+		s3Client, iamClient := SetS3Client(Log, ses), setIamClient(Log, ses)
+		// all the reconciles wait on the same limiter of each service
+		limitRequests(&s3Client.Handlers, s3.ServiceName)
+		limitRequests(&iamClient.Handlers, iam.ServiceName)
+		return s3Client, iamClient
 	}
 	return &s3.S3{}, &iam.IAM{}
 }
 
-func GetAwsClient(logger *logr.Logger, c client.Client) *AwsClient {
-	s3Client, iamClient := setClients(logger)
+// Identity is the account of the operator and the cluster that the bucket roles trust
+type Identity struct {
+	Partition string
+	AccountId string
+	// OidcIssuer of the cluster, without the scheme
+	OidcIssuer string
+}
+
+// NewAwsClient creates the aws client of the operator and discovers its identity. an error is returned when the
+// account or the oidc issuer is unknown, the operator would build invalid arns and trust policies without them
+func NewAwsClient(logger *logr.Logger, c client.Client, recorder record.EventRecorder) (*AwsClient, error) {
+	ses := CreateSession(logger)
+	partition, accountId, err := getAccountIdentity(logger, ses)
+	if err != nil {
+		return nil, err
+	}
+	oidcIssuer, err := getOidcIssuer(logger, ses)
+	if err != nil {
+		return nil, err
+	}
+	return NewAwsClientFromSession(logger, ses, c, recorder, Identity{Partition: partition, AccountId: accountId, OidcIssuer: oidcIssuer}), nil
+}
+
+// NewAwsClientFromSession creates an aws client of the session for an identity that is already known
+func NewAwsClientFromSession(logger *logr.Logger, ses *session.Session, c client.Client, recorder record.EventRecorder, identity Identity) *AwsClient {
+	s3Client, iamClient := setClients(logger, ses)
 	return &AwsClient{
-		s3Client:  s3Client,
-		Log:       logger,
-		iamClient: &IamClient{IamClient: iamClient, Log: logger},
+		s3Client:   s3Client,
+		iamClient:  &IamClient{IamClient: iamClient},
+		Recorder:   recorder,
+		k8sClient:  c,
+		oidcIssuer: identity.OidcIssuer,
+		partition:  identity.Partition,
+		accountId:  identity.AccountId,
 	}
 }
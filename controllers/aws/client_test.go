@@ -0,0 +1,44 @@
+package aws
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/PayU/K8s-S3-Operator/controllers/config"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	. "github.com/onsi/gomega"
+)
+
+func TestOperationDeadlineIsReleasedOnComplete(t *testing.T) {
+	g := NewWithT(t)
+	r := &request.Request{
+		Operation:   &request.Operation{Name: "DeleteObjects"},
+		HTTPRequest: httptest.NewRequest("POST", "https://bucket.s3.amazonaws.com/?delete", nil),
+	}
+	r.SetContext(context.Background())
+
+	setOperationDeadline(r)
+	deadline, hasDeadline := r.Context().Deadline()
+	g.Expect(hasDeadline).To(BeTrue())
+	g.Expect(deadline).To(BeTemporally("~", time.Now().Add(config.AwsOperationTimeout("DeleteObjects")), time.Second))
+	g.Expect(r.Context().Err()).NotTo(HaveOccurred())
+
+	releaseOperationDeadline(r)
+	g.Expect(r.Context().Err()).To(MatchError(context.Canceled))
+}
+
+// newTestSession returns a session that sends the requests of every aws service to the test server, without retries
+func newTestSession(server *httptest.Server) *session.Session {
+	return session.Must(session.NewSession(&aws.Config{
+		Region:           aws.String("eu-central-1"),
+		Endpoint:         aws.String(server.URL),
+		Credentials:      credentials.AnonymousCredentials,
+		S3ForcePathStyle: aws.Bool(true),
+		MaxRetries:       aws.Int(0),
+	}))
+}
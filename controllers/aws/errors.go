@@ -0,0 +1,88 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/PayU/K8s-S3-Operator/controllers/errorkind"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// errorCodeKinds maps the error codes of s3 and iam that are not throttling to their kind
+var errorCodeKinds = map[string]errorkind.Kind{
+	request.CanceledErrorCode:                         errorkind.Transient,
+	request.ErrCodeRequestError:                       errorkind.Transient,
+	request.ErrCodeResponseTimeout:                    errorkind.Transient,
+	"RequestTimeout":                                  errorkind.Transient,
+	"InternalError":                                   errorkind.Transient,
+	"ServiceUnavailable":                              errorkind.Transient,
+	"OperationAborted":                                errorkind.Transient,
+	"ExpiredToken":                                    errorkind.Transient,
+	iam.ErrCodeConcurrentModificationException:        errorkind.Transient,
+	iam.ErrCodeServiceFailureException:                errorkind.Transient,
+	iam.ErrCodeEntityTemporarilyUnmodifiableException: errorkind.Transient,
+
+	s3.ErrCodeBucketAlreadyExists:           errorkind.Conflict,
+	"BucketNotEmpty":                        errorkind.Conflict,
+	iam.ErrCodeEntityAlreadyExistsException: errorkind.Conflict,
+	iam.ErrCodeDeleteConflictException:      errorkind.Conflict,
+	iam.ErrCodeUnmodifiableEntityException:  errorkind.Conflict,
+
+	"InvalidBucketName":                         errorkind.Validation,
+	"InvalidArgument":                           errorkind.Validation,
+	"InvalidRequest":                            errorkind.Validation,
+	"InvalidLocationConstraint":                 errorkind.Validation,
+	"IllegalLocationConstraintException":        errorkind.Validation,
+	"MalformedPolicy":                           errorkind.Validation,
+	"MalformedXML":                              errorkind.Validation,
+	"ValidationError":                           errorkind.Validation,
+	iam.ErrCodeInvalidInputException:            errorkind.Validation,
+	iam.ErrCodeMalformedPolicyDocumentException: errorkind.Validation,
+	iam.ErrCodePolicyNotAttachableException:     errorkind.Validation,
+
+	"AccessDenied":          errorkind.PermissionDenied,
+	"AccessDeniedException": errorkind.PermissionDenied,
+	"AllAccessDisabled":     errorkind.PermissionDenied,
+	"InvalidAccessKeyId":    errorkind.PermissionDenied,
+	"InvalidClientTokenId":  errorkind.PermissionDenied,
+	"SignatureDoesNotMatch": errorkind.PermissionDenied,
+}
+
+// ErrorKind classifies an error that was returned by the aws client, errors of the
+// operator itself are classified where they are raised and aws errors by their code
+func ErrorKind(err error) errorkind.Kind {
+	if kind, found := errorkind.Of(err); found {
+		return kind
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return errorkind.Transient
+	}
+	var awsErr awserr.Error
+	if !errors.As(err, &awsErr) {
+		return errorkind.Unknown
+	}
+	// s3 throttles with SlowDown, which is not one of the throttling codes of the sdk
+	if request.IsErrorThrottle(awsErr) || awsErr.Code() == "SlowDown" {
+		return errorkind.Throttling
+	}
+	if kind, found := errorCodeKinds[awsErr.Code()]; found {
+		return kind
+	}
+	// errors without a known code are classified by the status code of the response
+	var requestFailure awserr.RequestFailure
+	if errors.As(err, &requestFailure) {
+		switch statusCode := requestFailure.StatusCode(); {
+		case statusCode == http.StatusTooManyRequests:
+			return errorkind.Throttling
+		case statusCode >= http.StatusInternalServerError:
+			return errorkind.Transient
+		case statusCode == http.StatusForbidden:
+			return errorkind.PermissionDenied
+		}
+	}
+	return errorkind.Unknown
+}
@@ -0,0 +1,45 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	s3operatorv1 "github.com/PayU/K8s-S3-Operator/api/v1"
+	"github.com/PayU/K8s-S3-Operator/controllers/errorkind"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	. "github.com/onsi/gomega"
+)
+
+func TestErrorKind(t *testing.T) {
+	g := NewWithT(t)
+	errorKinds := []struct {
+		err  error
+		kind errorkind.Kind
+	}{
+		{awserr.New("SlowDown", "please reduce your request rate", nil), errorkind.Throttling},
+		{awserr.New("Throttling", "rate exceeded", nil), errorkind.Throttling},
+		{awserr.New("RequestError", "send request failed", errors.New("connection reset")), errorkind.Transient},
+		{awserr.NewRequestFailure(awserr.New("Unknown", "internal", nil), 503, "id"), errorkind.Transient},
+		{fmt.Errorf("bucket creation step CreateBucket failed: %w", awserr.New(s3.ErrCodeBucketAlreadyExists, "", nil)), errorkind.Conflict},
+		{awserr.New("MalformedPolicy", "invalid principal", nil), errorkind.Validation},
+		{awserr.New("AccessDenied", "access denied", nil), errorkind.PermissionDenied},
+		{awserr.New("NoSuchEntity", "role not found", nil), errorkind.Unknown},
+		{context.DeadlineExceeded, errorkind.Transient},
+		{errors.New("iam role of the bucket is not ready"), errorkind.Unknown},
+	}
+	for _, errorKind := range errorKinds {
+		g.Expect(ErrorKind(errorKind.err)).To(Equal(errorKind.kind), errorKind.err.Error())
+	}
+}
+
+func TestOperatorErrorsAreClassified(t *testing.T) {
+	g := NewWithT(t)
+	a := &AwsClient{}
+
+	g.Expect(ErrorKind(a.ValidateBucketName("xn--bucket"))).To(Equal(errorkind.Validation))
+	_, err := bucketAccessStatements("arn:aws:s3:::bucket", &s3operatorv1.BucketAccess{Level: s3operatorv1.AccessLevelCustom})
+	g.Expect(ErrorKind(err)).To(Equal(errorkind.Validation))
+}
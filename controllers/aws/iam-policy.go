@@ -0,0 +1,261 @@
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+
+	s3operatorv1 "github.com/PayU/K8s-S3-Operator/api/v1"
+	"github.com/PayU/K8s-S3-Operator/controllers/errorkind"
+	"github.com/go-logr/logr"
+)
+
+// getRolePolicyName returns the name of the inline policy that the operator puts on the bucket role
+func getRolePolicyName(bucketName string) string {
+	return bucketName + "-S3Operator"
+}
+
+// objectActionsOfLevel are the actions on the bucket objects that every access level allows
+var objectActionsOfLevel = map[s3operatorv1.AccessLevel][]string{
+	s3operatorv1.AccessLevelReadOnly: {
+		"s3:GetObject",
+		"s3:GetObjectVersion",
+		"s3:GetObjectTagging",
+	},
+	s3operatorv1.AccessLevelWriteOnly: {
+		"s3:PutObject",
+		"s3:PutObjectTagging",
+		"s3:AbortMultipartUpload",
+		"s3:ListMultipartUploadParts",
+	},
+	s3operatorv1.AccessLevelReadWrite: {
+		"s3:GetObject",
+		"s3:GetObjectVersion",
+		"s3:GetObjectTagging",
+		"s3:PutObject",
+		"s3:PutObjectTagging",
+		"s3:DeleteObject",
+		"s3:DeleteObjectVersion",
+		"s3:AbortMultipartUpload",
+		"s3:ListMultipartUploadParts",
+	},
+}
+
+// buildRolePolicy returns the inline policy of the bucket role
+func buildRolePolicy(partition string, bucketArn string, bucketSpec *s3operatorv1.S3BucketSpec) (map[string]interface{}, error) {
+	statements, err := bucketAccessStatements(bucketArn, bucketSpec.Access)
+	if err != nil {
+		return nil, err
+	}
+	if statement := kmsKeyStatement(partition, bucketSpec.GetEncryption()); statement != nil {
+		statements = append(statements, statement)
+	}
+	return map[string]interface{}{
+		"Version":   "2012-10-17",
+		"Statement": statements,
+	}, nil
+}
+
+// buildBucketPolicy returns the bucket policy that grants the bucket role the same access as its inline policy
+func buildBucketPolicy(bucketArn string, roleArn string, access *s3operatorv1.BucketAccess) (map[string]interface{}, error) {
+	statements, err := bucketAccessStatements(bucketArn, access)
+	if err != nil {
+		return nil, err
+	}
+	for _, statement := range statements {
+		statement["Principal"] = map[string]interface{}{"AWS": roleArn}
+	}
+	return map[string]interface{}{
+		"Version":   "2012-10-17",
+		"Statement": statements,
+	}, nil
+}
+
+// bucketAccessStatements returns the statements of the access level, scoped to the bucket and the key prefixes.
+// listing the bucket is limited to the prefixes as well, except for the custom level that gets its actions as is
+func bucketAccessStatements(bucketArn string, access *s3operatorv1.BucketAccess) ([]map[string]interface{}, error) {
+	level := s3operatorv1.AccessLevelReadWrite
+	var prefixes []string
+	if access != nil {
+		if access.Level != "" {
+			level = access.Level
+		}
+		prefixes = access.Prefixes
+	}
+	objectResources := []string{bucketArn + "/*"}
+	if len(prefixes) > 0 {
+		objectResources = make([]string, 0, len(prefixes))
+		listPrefixes := make([]string, 0, len(prefixes))
+		for _, prefix := range prefixes {
+			prefix = strings.TrimPrefix(prefix, "/")
+			objectResources = append(objectResources, bucketArn+"/"+prefix+"*")
+			listPrefixes = append(listPrefixes, prefix+"*")
+		}
+		prefixes = listPrefixes
+	}
+
+	if level == s3operatorv1.AccessLevelCustom {
+		if len(access.Actions) == 0 {
+			return nil, errorkind.New(errorkind.Validation, "access level custom requires at least one action")
+		}
+		return []map[string]interface{}{{
+			"Sid":      "BucketAccess",
+			"Effect":   "Allow",
+			"Action":   access.Actions,
+			"Resource": append([]string{bucketArn}, objectResources...),
+		}}, nil
+	}
+	objectActions, isLevelExists := objectActionsOfLevel[level]
+	if !isLevelExists {
+		return nil, errorkind.New(errorkind.Validation, "unknown access level "+string(level))
+	}
+	bucketActions := []string{"s3:GetBucketLocation"}
+	if level != s3operatorv1.AccessLevelReadOnly {
+		bucketActions = append(bucketActions, "s3:ListBucketMultipartUploads")
+	}
+	statements := []map[string]interface{}{{
+		"Sid":      "BucketAccess",
+		"Effect":   "Allow",
+		"Action":   bucketActions,
+		"Resource": bucketArn,
+	}}
+	if level != s3operatorv1.AccessLevelWriteOnly {
+		listStatement := map[string]interface{}{
+			"Sid":      "ListBucket",
+			"Effect":   "Allow",
+			"Action":   "s3:ListBucket",
+			"Resource": bucketArn,
+		}
+		if len(prefixes) > 0 {
+			listStatement["Condition"] = map[string]interface{}{
+				"StringLike": map[string]interface{}{"s3:prefix": prefixes},
+			}
+		}
+		statements = append(statements, listStatement)
+	}
+	statements = append(statements, map[string]interface{}{
+		"Sid":      "ObjectAccess",
+		"Effect":   "Allow",
+		"Action":   objectActions,
+		"Resource": objectResources,
+	})
+	return statements, nil
+}
+
+// updateRolePolicy puts the inline policy of the bucket role when it differs from the one in aws,
+// the returned bool is true when the policy was changed
+func (a *AwsClient) updateRolePolicy(ctx context.Context, roleName string, bucketName string, bucketSpec *s3operatorv1.S3BucketSpec) (bool, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	log.V(1).Info("UpdateRolePolicy function", "role_name", roleName)
+	rolePolicy, err := buildRolePolicy(a.partition, a.GetBucketArn(bucketName), bucketSpec)
+	if err != nil {
+		return false, err
+	}
+	policyName := getRolePolicyName(bucketName)
+	currentPolicy, err := a.iamClient.getRolePolicy(ctx, roleName, policyName)
+	if err != nil {
+		return false, err
+	}
+	policy, err := json.Marshal(rolePolicy)
+	if err != nil {
+		log.Error(err, "error in UpdateRolePolicy in Marshal", "role_name", roleName)
+		return false, err
+	}
+	if currentPolicy != "" && isPolicyEqual(currentPolicy, string(policy)) {
+		log.V(1).Info("no role policy to update", "role_name", roleName)
+		return false, nil
+	}
+	_, err = a.iamClient.putRolePolicy(ctx, roleName, policyName, string(policy))
+	return true, err
+}
+
+// isPolicyEqual compares two policy documents, regardless of the changes aws makes when it stores a policy
+func isPolicyEqual(policy string, otherPolicy string) bool {
+	var document, otherDocument interface{}
+	if json.Unmarshal([]byte(policy), &document) != nil || json.Unmarshal([]byte(otherPolicy), &otherDocument) != nil {
+		return false
+	}
+	return reflect.DeepEqual(normalizePolicy(document), normalizePolicy(otherDocument))
+}
+
+// normalizePolicy replaces a list of one element with the element itself and sorts lists of strings,
+// aws treats both forms the same
+func normalizePolicy(value interface{}) interface{} {
+	switch typedValue := value.(type) {
+	case map[string]interface{}:
+		for key, val := range typedValue {
+			typedValue[key] = normalizePolicy(val)
+		}
+		return typedValue
+	case []interface{}:
+		if len(typedValue) == 1 {
+			return normalizePolicy(typedValue[0])
+		}
+		strValues := make([]string, 0, len(typedValue))
+		for i, val := range typedValue {
+			typedValue[i] = normalizePolicy(val)
+			if strValue, isStr := typedValue[i].(string); isStr {
+				strValues = append(strValues, strValue)
+			}
+		}
+		if len(strValues) == len(typedValue) {
+			sort.Strings(strValues)
+			for i, strValue := range strValues {
+				typedValue[i] = strValue
+			}
+		}
+		return typedValue
+	}
+	return value
+}
+
+// validateIamRole returns an error when the iam role of the spec cant be applied
+func validateIamRole(bucketSpec *s3operatorv1.S3BucketSpec) error {
+	if isExistingRole(bucketSpec) && len(bucketSpec.IamRole.ManagedPolicyArns) > 0 {
+		return errorkind.New(errorkind.Validation, "managedPolicyArns can be used only with a role that the operator creates")
+	}
+	return nil
+}
+
+// updateRoleManagedPolicies attaches the managed policies of the spec to the role and detaches the others,
+// the returned bool is true when the attached policies were changed
+func (a *AwsClient) updateRoleManagedPolicies(ctx context.Context, roleName string, policyArns []string) (bool, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	log.V(1).Info("UpdateRoleManagedPolicies function", "role_name", roleName)
+	if _, err := a.getManagedRole(ctx, roleName); err != nil {
+		return false, err
+	}
+	attachedPolicyArns, err := a.iamClient.listAttachedRolePolicies(ctx, roleName)
+	if err != nil {
+		return false, err
+	}
+	isChanged := false
+	for _, policyArn := range policyArns {
+		if !containsString(attachedPolicyArns, policyArn) {
+			if _, err = a.iamClient.attachRolePolicy(ctx, roleName, policyArn); err != nil {
+				return isChanged, err
+			}
+			isChanged = true
+		}
+	}
+	for _, policyArn := range attachedPolicyArns {
+		if !containsString(policyArns, policyArn) {
+			if _, err = a.iamClient.detachRolePolicy(ctx, roleName, policyArn); err != nil {
+				return isChanged, err
+			}
+			isChanged = true
+		}
+	}
+	return isChanged, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, val := range values {
+		if val == value {
+			return true
+		}
+	}
+	return false
+}
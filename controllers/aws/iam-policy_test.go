@@ -0,0 +1,89 @@
+package aws
+
+import (
+	"encoding/json"
+	"testing"
+
+	s3operatorv1 "github.com/PayU/K8s-S3-Operator/api/v1"
+	. "github.com/onsi/gomega"
+)
+
+// unit test , test building and comparing of iam policies
+
+func TestIsPolicyEqualIgnoresAwsNormalization(t *testing.T) {
+	g := NewWithT(t)
+	policy := `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":["s3:PutObject","s3:GetObject"],"Resource":["arn:aws:s3:::bucket/*"]}]}`
+	fromAws := `{"Version":"2012-10-17","Statement":{"Effect":"Allow","Action":["s3:GetObject","s3:PutObject"],"Resource":"arn:aws:s3:::bucket/*"}}`
+	changed := `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":["s3:GetObject"],"Resource":["arn:aws:s3:::bucket/*"]}]}`
+
+	g.Expect(isPolicyEqual(policy, fromAws)).To(BeTrue())
+	g.Expect(isPolicyEqual(policy, changed)).To(BeFalse())
+	g.Expect(isPolicyEqual(policy, "not a policy")).To(BeFalse())
+}
+
+func TestKmsKeyStatement(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(kmsKeyStatement("aws", nil)).To(BeNil())
+	g.Expect(kmsKeyStatement("aws", &s3operatorv1.BucketEncryption{Algorithm: "AES256"})).To(BeNil())
+	g.Expect(kmsKeyStatement("aws", &s3operatorv1.BucketEncryption{Algorithm: "aws:kms"})).To(BeNil())
+
+	keyArn := "arn:aws:kms:eu-central-1:111122223333:key/1234abcd-12ab-34cd-56ef-1234567890ab"
+	statement := kmsKeyStatement("aws", &s3operatorv1.BucketEncryption{Algorithm: "aws:kms", KmsKeyId: keyArn})
+	g.Expect(statement["Resource"]).To(Equal(keyArn))
+	g.Expect(statement["Action"]).To(ConsistOf("kms:Decrypt", "kms:GenerateDataKey"))
+
+	statement = kmsKeyStatement("aws", &s3operatorv1.BucketEncryption{Algorithm: "aws:kms", KmsKeyId: "alias/bucket-key"})
+	g.Expect(statement["Resource"]).To(Equal("*"))
+	condition, err := json.Marshal(statement["Condition"])
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(condition)).To(ContainSubstring(`"kms:ResourceAliases":"alias/bucket-key"`))
+}
+
+func TestBucketAccessStatements(t *testing.T) {
+	g := NewWithT(t)
+	bucketArn := "arn:aws:s3:::bucket"
+
+	statements, err := bucketAccessStatements(bucketArn, nil)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(statements).To(HaveLen(3))
+	g.Expect(statements[2]["Action"]).To(ContainElements("s3:GetObject", "s3:PutObject", "s3:DeleteObject"))
+	g.Expect(statements[2]["Resource"]).To(ConsistOf(bucketArn + "/*"))
+
+	statements, err = bucketAccessStatements(bucketArn, &s3operatorv1.BucketAccess{
+		Level:    s3operatorv1.AccessLevelReadOnly,
+		Prefixes: []string{"/reports/", "logs/"},
+	})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(statements[1]["Condition"]).To(HaveKeyWithValue("StringLike",
+		HaveKeyWithValue("s3:prefix", ConsistOf("reports/*", "logs/*"))))
+	g.Expect(statements[2]["Action"]).NotTo(ContainElement("s3:PutObject"))
+	g.Expect(statements[2]["Resource"]).To(ConsistOf(bucketArn+"/reports/*", bucketArn+"/logs/*"))
+
+	statements, err = bucketAccessStatements(bucketArn, &s3operatorv1.BucketAccess{Level: s3operatorv1.AccessLevelWriteOnly})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(statements).To(HaveLen(2))
+	g.Expect(statements[1]["Action"]).NotTo(ContainElement("s3:GetObject"))
+
+	_, err = bucketAccessStatements(bucketArn, &s3operatorv1.BucketAccess{Level: s3operatorv1.AccessLevelCustom})
+	g.Expect(err).To(HaveOccurred())
+	statements, err = bucketAccessStatements(bucketArn, &s3operatorv1.BucketAccess{
+		Level:   s3operatorv1.AccessLevelCustom,
+		Actions: []string{"s3:GetObject"},
+	})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(statements[0]["Resource"]).To(ConsistOf(bucketArn, bucketArn+"/*"))
+}
+
+func TestBuildBucketPolicyGrantsTheRole(t *testing.T) {
+	g := NewWithT(t)
+	roleArn := "arn:aws:iam::111122223333:role/bucket-role"
+	policy, err := buildBucketPolicy("arn:aws:s3:::bucket", roleArn, nil)
+	g.Expect(err).NotTo(HaveOccurred())
+	document, err := json.Marshal(policy)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(document)).NotTo(ContainSubstring(`"s3:*"`))
+	for _, statement := range policy["Statement"].([]map[string]interface{}) {
+		g.Expect(statement["Principal"]).To(Equal(map[string]interface{}{"AWS": roleArn}))
+	}
+}
@@ -1,67 +1,237 @@
 package aws
 
 import (
-	"encoding/json"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"text/template"
+
+	s3operatorv1 "github.com/PayU/K8s-S3-Operator/api/v1"
+	"github.com/PayU/K8s-S3-Operator/controllers/config"
+	"github.com/PayU/K8s-S3-Operator/controllers/dryrun"
+	"github.com/PayU/K8s-S3-Operator/controllers/errorkind"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/iam"
 	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
 )
 
 type IamClient struct {
 	IamClient *iam.IAM
-	Log       *logr.Logger
-}
-
-func (c IamClient) createIamRole(roleName string, Tag *iam.Tag, log *logr.Logger) (*iam.CreateRoleOutput, error) {
-	c.Log = log
-	c.Log.Info("Creating IAM role for s3 bucket", "role_name", roleName)
-	policy, err := json.Marshal(map[string]interface{}{
-		"Version": "2012-10-17",
-		"Statement": []map[string]interface{}{
-			{
-				"Action": []string{
-					"s3:*",
-				},
-				"Effect":   "Allow",
-				"Resource": "*",
-			},
-		},
-	})
+}
+
+func (c IamClient) createIamRole(ctx context.Context, input *iam.CreateRoleInput) (*iam.CreateRoleOutput, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	log.Info("Creating IAM role for s3 bucket", "role_name", input.RoleName, "role_path", input.Path)
+	res, err := c.IamClient.CreateRoleWithContext(ctx, input)
 	if err != nil {
-		c.Log.Error(err, "error in CreateIamRole in Marshal")
-		return nil, err
+		log.Error(err, "error in CreateIamRole in CreateRole", "role_name", input.RoleName)
+	} else {
+		log.Info("Create IAM for s3 bucket finished successfully", "role_from_res", res.Role)
 	}
-	input := iam.CreateRoleInput{
-		RoleName:                 &roleName,
-		Tags:                     []*iam.Tag{Tag},
-		AssumeRolePolicyDocument: aws.String(string(policy)),
+	return res, err
+}
+
+func (c IamClient) getRole(ctx context.Context, roleName string) (*iam.Role, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	res, err := c.IamClient.GetRoleWithContext(ctx, &iam.GetRoleInput{RoleName: &roleName})
+	if err != nil {
+		log.Error(err, "error in GetRole", "role_name", roleName)
+		return nil, err
 	}
-	res, err := c.IamClient.CreateRole(&input)
+	return res.Role, nil
+}
+
+func (c IamClient) updateAssumeRolePolicy(ctx context.Context, roleName string, trustPolicy string) (*iam.UpdateAssumeRolePolicyOutput, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	log.Info("UpdateAssumeRolePolicy function", "role_name", roleName)
+	res, err := c.IamClient.UpdateAssumeRolePolicyWithContext(ctx, &iam.UpdateAssumeRolePolicyInput{RoleName: &roleName, PolicyDocument: &trustPolicy})
 	if err != nil {
-		c.Log.Error(err, "error in CreateIamRole in CreateRole", "role_name", roleName)
+		log.Error(err, "error in UpdateAssumeRolePolicy", "role_name", roleName, "policy", trustPolicy)
 	} else {
-		c.Log.Info("Create IAM for s3 bucket finished successfully", "role_from_res", res.Role)
+		log.Info("succeded to update role trust policy", "role_name", roleName, "policy", trustPolicy)
 	}
 	return res, err
 }
 
-func (c IamClient) deleteIamRole(roleName string, log *logr.Logger) (*iam.DeleteRoleOutput, error) {
-	c.Log = log
-	c.Log.Info("DeleteIamRole function", "role_name", roleName)
+func (c IamClient) deleteIamRole(ctx context.Context, roleName string) (*iam.DeleteRoleOutput, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	log.Info("DeleteIamRole function", "role_name", roleName)
 	input := iam.DeleteRoleInput{
 		RoleName: &roleName,
 	}
-	res, err := c.IamClient.DeleteRole(&input)
+	res, err := c.IamClient.DeleteRoleWithContext(ctx, &input)
 	if err != nil {
-		c.Log.Error(err, "error in DeleteIamRole in DeleteRole", "role_name", roleName)
+		log.Error(err, "error in DeleteIamRole in DeleteRole", "role_name", roleName)
 	} else {
-		c.Log.Info("succeded to delete iam role", "role_name", roleName)
+		log.Info("succeded to delete iam role", "role_name", roleName)
+	}
+	return res, err
+}
+func (c IamClient) untagIamRole(ctx context.Context, roleName string, tagKeys ...string) (*iam.UntagRoleOutput, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	log.Info("UntagIamRole function", "role_name", roleName, "tag_keys", tagKeys)
+	res, err := c.IamClient.UntagRoleWithContext(ctx, &iam.UntagRoleInput{RoleName: &roleName, TagKeys: aws.StringSlice(tagKeys)})
+	if err != nil {
+		log.Error(err, "error in UntagIamRole in UntagRole", "role_name", roleName)
 	}
 	return res, err
 }
+func (c IamClient) tagIamRole(ctx context.Context, roleName string, tags []*iam.Tag) (*iam.TagRoleOutput, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	log.Info("TagIamRole function", "role_name", roleName, "tags", tags)
+	res, err := c.IamClient.TagRoleWithContext(ctx, &iam.TagRoleInput{RoleName: &roleName, Tags: tags})
+	if err != nil {
+		log.Error(err, "error in TagIamRole in TagRole", "role_name", roleName)
+	}
+	return res, err
+}
+func (c IamClient) putRolePermissionsBoundary(ctx context.Context, roleName string, boundaryArn string) (*iam.PutRolePermissionsBoundaryOutput, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	log.Info("PutRolePermissionsBoundary function", "role_name", roleName, "permissions_boundary", boundaryArn)
+	res, err := c.IamClient.PutRolePermissionsBoundaryWithContext(ctx, &iam.PutRolePermissionsBoundaryInput{RoleName: &roleName, PermissionsBoundary: &boundaryArn})
+	if err != nil {
+		log.Error(err, "error in PutRolePermissionsBoundary", "role_name", roleName)
+	}
+	return res, err
+}
+func (c IamClient) updateRoleMaxSessionDuration(ctx context.Context, roleName string, maxSessionDuration int64) (*iam.UpdateRoleOutput, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	log.Info("UpdateRole function", "role_name", roleName, "max_session_duration", maxSessionDuration)
+	res, err := c.IamClient.UpdateRoleWithContext(ctx, &iam.UpdateRoleInput{RoleName: &roleName, MaxSessionDuration: &maxSessionDuration})
+	if err != nil {
+		log.Error(err, "error in UpdateRole", "role_name", roleName)
+	}
+	return res, err
+}
+func (c IamClient) putRolePolicy(ctx context.Context, roleName string, policyName string, policy string) (*iam.PutRolePolicyOutput, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	log.Info("PutRolePolicy function", "role_name", roleName, "policy_name", policyName)
+	res, err := c.IamClient.PutRolePolicyWithContext(ctx, &iam.PutRolePolicyInput{RoleName: &roleName, PolicyName: &policyName, PolicyDocument: &policy})
+	if err != nil {
+		log.Error(err, "error in PutRolePolicy", "role_name", roleName, "policy", policy)
+	} else {
+		log.Info("succeded to put role policy", "role_name", roleName, "policy", policy)
+	}
+	return res, err
+}
+
+// getRolePolicy returns the decoded inline policy of the role, empty when the policy not exists
+func (c IamClient) getRolePolicy(ctx context.Context, roleName string, policyName string) (string, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	res, err := c.IamClient.GetRolePolicyWithContext(ctx, &iam.GetRolePolicyInput{RoleName: &roleName, PolicyName: &policyName})
+	if err != nil {
+		if awsErr, isAwsErr := err.(awserr.Error); isAwsErr && awsErr.Code() == iam.ErrCodeNoSuchEntityException {
+			return "", nil
+		}
+		log.Error(err, "error in GetRolePolicy", "role_name", roleName, "policy_name", policyName)
+		return "", err
+	}
+	policy, err := url.QueryUnescape(aws.StringValue(res.PolicyDocument))
+	if err != nil {
+		log.Error(err, "error to decode role policy", "role_name", roleName, "policy_name", policyName)
+	}
+	return policy, err
+}
+
+func (c IamClient) deleteRolePolicy(ctx context.Context, roleName string, policyName string) (*iam.DeleteRolePolicyOutput, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	log.Info("DeleteRolePolicy function", "role_name", roleName, "policy_name", policyName)
+	res, err := c.IamClient.DeleteRolePolicyWithContext(ctx, &iam.DeleteRolePolicyInput{RoleName: &roleName, PolicyName: &policyName})
+	if err != nil {
+		log.Error(err, "error in DeleteRolePolicy", "role_name", roleName, "policy_name", policyName)
+	}
+	return res, err
+}
+
+func (c IamClient) attachRolePolicy(ctx context.Context, roleName string, policyArn string) (*iam.AttachRolePolicyOutput, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	log.Info("AttachRolePolicy function", "role_name", roleName, "policy_arn", policyArn)
+	res, err := c.IamClient.AttachRolePolicyWithContext(ctx, &iam.AttachRolePolicyInput{RoleName: &roleName, PolicyArn: &policyArn})
+	if err != nil {
+		log.Error(err, "error in AttachRolePolicy", "role_name", roleName, "policy_arn", policyArn)
+	}
+	return res, err
+}
+
+func (c IamClient) detachRolePolicy(ctx context.Context, roleName string, policyArn string) (*iam.DetachRolePolicyOutput, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	log.Info("DetachRolePolicy function", "role_name", roleName, "policy_arn", policyArn)
+	res, err := c.IamClient.DetachRolePolicyWithContext(ctx, &iam.DetachRolePolicyInput{RoleName: &roleName, PolicyArn: &policyArn})
+	if err != nil {
+		log.Error(err, "error in DetachRolePolicy", "role_name", roleName, "policy_arn", policyArn)
+	}
+	return res, err
+}
+
+// listAttachedRolePolicies returns the arns of the managed policies that are attached to the role
+func (c IamClient) listAttachedRolePolicies(ctx context.Context, roleName string) ([]string, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	policyArns := []string{}
+	err := c.IamClient.ListAttachedRolePoliciesPagesWithContext(ctx, &iam.ListAttachedRolePoliciesInput{RoleName: &roleName},
+		func(page *iam.ListAttachedRolePoliciesOutput, lastPage bool) bool {
+			for _, policy := range page.AttachedPolicies {
+				policyArns = append(policyArns, aws.StringValue(policy.PolicyArn))
+			}
+			return true
+		})
+	if err != nil {
+		log.Error(err, "error in ListAttachedRolePolicies", "role_name", roleName)
+	}
+	return policyArns, err
+}
+
+// listRolePolicies returns the names of the inline policies of the role
+func (c IamClient) listRolePolicies(ctx context.Context, roleName string) ([]string, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	policyNames := []string{}
+	err := c.IamClient.ListRolePoliciesPagesWithContext(ctx, &iam.ListRolePoliciesInput{RoleName: &roleName},
+		func(page *iam.ListRolePoliciesOutput, lastPage bool) bool {
+			policyNames = append(policyNames, aws.StringValueSlice(page.PolicyNames)...)
+			return true
+		})
+	if err != nil {
+		log.Error(err, "error in ListRolePolicies", "role_name", roleName)
+	}
+	return policyNames, err
+}
+
+// listInstanceProfilesForRole returns the names of the instance profiles that contain the role
+func (c IamClient) listInstanceProfilesForRole(ctx context.Context, roleName string) ([]string, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	instanceProfileNames := []string{}
+	err := c.IamClient.ListInstanceProfilesForRolePagesWithContext(ctx, &iam.ListInstanceProfilesForRoleInput{RoleName: &roleName},
+		func(page *iam.ListInstanceProfilesForRoleOutput, lastPage bool) bool {
+			for _, instanceProfile := range page.InstanceProfiles {
+				instanceProfileNames = append(instanceProfileNames, aws.StringValue(instanceProfile.InstanceProfileName))
+			}
+			return true
+		})
+	if err != nil {
+		log.Error(err, "error in ListInstanceProfilesForRole", "role_name", roleName)
+	}
+	return instanceProfileNames, err
+}
+
+func (c IamClient) removeRoleFromInstanceProfile(ctx context.Context, roleName string, instanceProfileName string) (*iam.RemoveRoleFromInstanceProfileOutput, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	log.Info("RemoveRoleFromInstanceProfile function", "role_name", roleName, "instance_profile", instanceProfileName)
+	res, err := c.IamClient.RemoveRoleFromInstanceProfileWithContext(ctx, &iam.RemoveRoleFromInstanceProfileInput{RoleName: &roleName, InstanceProfileName: &instanceProfileName})
+	if err != nil {
+		log.Error(err, "error in RemoveRoleFromInstanceProfile", "role_name", roleName, "instance_profile", instanceProfileName)
+	}
+	return res, err
+}
+
 func setIamClient(Log *logr.Logger, ses *session.Session) *iam.IAM {
 	Log.Info("create iamClient wit session", "session", *ses)
 	iamClient := iam.New(ses)
@@ -74,8 +244,310 @@ func setIamClient(Log *logr.Logger, ses *session.Session) *iam.IAM {
 	return iamClient
 
 }
-func GetRoleName(bucketName string) string {
-	roleName := bucketName + "IAM-ROLE-S3Operator"
-	iamRole := "arn:aws:iam:::role/" + roleName
-	return iamRole
-}
\ No newline at end of file
+
+// createBucketRole creates the role of the bucket with its trust policy and managed policies,
+// a role that was not created by the operator is only validated. the name of the role is returned
+func (a *AwsClient) createBucketRole(ctx context.Context, s3Bucket *s3operatorv1.S3Bucket) (string, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	status := &s3Bucket.Status
+	if err := validateIamRole(&s3Bucket.Spec); err != nil {
+		return "", err
+	}
+	roleName, err := a.GetRoleName(s3Bucket)
+	if err != nil {
+		return "", err
+	}
+	if isExistingRole(&s3Bucket.Spec) {
+		status.IamRoleArn = s3Bucket.Spec.IamRole.Arn
+		_, err = a.iamClient.getRole(ctx, roleName)
+		return roleName, err
+	}
+	status.IamRoleName = roleName
+	trustPolicy, err := a.trustPolicyDocument(ctx, s3Bucket.Namespace, s3Bucket.Spec.Serviceaccount)
+	if err != nil {
+		return roleName, err
+	}
+	input := &iam.CreateRoleInput{
+		RoleName:                 aws.String(roleName),
+		Path:                     aws.String(config.RolePath()),
+		AssumeRolePolicyDocument: aws.String(trustPolicy),
+		MaxSessionDuration:       aws.Int64(config.RoleMaxSessionDuration()),
+		Tags:                     roleTagsFromSpec(s3Bucket.Spec.Tags),
+	}
+	if config.PermissionsBoundaryArn() != "" {
+		input.PermissionsBoundary = aws.String(config.PermissionsBoundaryArn())
+	}
+	res, err := a.iamClient.createIamRole(ctx, input)
+	if err == nil {
+		status.IamRoleArn = aws.StringValue(res.Role.Arn)
+	} else {
+		if awsErr, isAwsErr := err.(awserr.Error); !isAwsErr || awsErr.Code() != iam.ErrCodeEntityAlreadyExistsException {
+			return roleName, err
+		}
+		// the role is left from a previous attempt of the creation, it is adopted only when it has the managed tag
+		role, err := a.iamClient.getRole(ctx, roleName)
+		if err != nil {
+			return roleName, err
+		}
+		if !hasManagedTag(role.Tags) {
+			return roleName, errorkind.Errorf(errorkind.Conflict, "iam role %s already exists and is not managed by the operator", roleName)
+		}
+		log.Info("iam role already exists, continue with it", "role_name", roleName)
+		status.IamRoleArn = aws.StringValue(role.Arn)
+	}
+	_, err = a.updateRoleManagedPolicies(ctx, roleName, managedPolicyArns(&s3Bucket.Spec))
+	return roleName, err
+}
+
+// createMissingRole creates the role of the bucket when it not exists in aws, e.g. it was deleted outside of the operator
+// or the bucket was created before the operator built a valid role name. the returned bool is true when the role was created
+func (a *AwsClient) createMissingRole(ctx context.Context, s3Bucket *s3operatorv1.S3Bucket, roleName string) (bool, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	_, err := a.iamClient.getRole(ctx, roleName)
+	if err == nil || !isNoSuchEntityError(err) {
+		return false, err
+	}
+	log.Info("iam role of the bucket not exists, creating it", "role_name", roleName)
+	if plan := dryrun.FromContext(ctx); plan != nil {
+		// the role is created together with its policies, like the creation step of the role
+		plan.Add(iam.ServiceName, StepIamRole, roleName)
+		return true, nil
+	}
+	if _, err = a.createBucketRole(ctx, s3Bucket); err != nil {
+		return false, err
+	}
+	a.Recorder.Eventf(s3Bucket, corev1.EventTypeNormal, s3operatorv1.EventRoleCreated, "iam role %s was created", roleName)
+	return true, nil
+}
+
+// getManagedRole returns the role only when it has the managed tag, a role without it was not created
+// by the operator and it is never changed
+func (a *AwsClient) getManagedRole(ctx context.Context, roleName string) (*iam.Role, error) {
+	role, err := a.iamClient.getRole(ctx, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if !hasManagedTag(role.Tags) {
+		return nil, errorkind.Errorf(errorkind.Conflict, "iam role %s is not managed by the operator", roleName)
+	}
+	return role, nil
+}
+
+func hasManagedTag(tags []*iam.Tag) bool {
+	defaultTag := config.DefaultTag()
+	for _, tag := range tags {
+		if aws.StringValue(tag.Key) == *defaultTag.Key && aws.StringValue(tag.Value) == *defaultTag.Value {
+			return true
+		}
+	}
+	return false
+}
+
+// roleTagsFromSpec returns the managed tag and the tags of the spec with the operator prefix, like the bucket tags
+func roleTagsFromSpec(tags map[string]string) []*iam.Tag {
+	defaultTag := config.DefaultTag()
+	roleTags := []*iam.Tag{{Key: defaultTag.Key, Value: defaultTag.Value}}
+	for key, val := range tags {
+		roleTags = append(roleTags, &iam.Tag{Key: aws.String(config.TagPrefix() + key), Value: aws.String(val)})
+	}
+	return roleTags
+}
+
+// updateRoleSettings corrects drift of the permissions boundary, the max session duration and the tags of the role,
+// tags without the operator prefix are kept. the returned bool is true when the role was changed
+func (a *AwsClient) updateRoleSettings(ctx context.Context, roleName string, tags map[string]string) (bool, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	log.V(1).Info("UpdateRoleSettings function", "role_name", roleName)
+	role, err := a.getManagedRole(ctx, roleName)
+	if err != nil {
+		return false, err
+	}
+	isChanged := false
+	boundaryArn := config.PermissionsBoundaryArn()
+	if boundaryArn != "" && (role.PermissionsBoundary == nil || aws.StringValue(role.PermissionsBoundary.PermissionsBoundaryArn) != boundaryArn) {
+		if _, err = a.iamClient.putRolePermissionsBoundary(ctx, roleName, boundaryArn); err != nil {
+			return isChanged, err
+		}
+		isChanged = true
+	}
+	if aws.Int64Value(role.MaxSessionDuration) != config.RoleMaxSessionDuration() {
+		if _, err = a.iamClient.updateRoleMaxSessionDuration(ctx, roleName, config.RoleMaxSessionDuration()); err != nil {
+			return isChanged, err
+		}
+		isChanged = true
+	}
+	tagsToPut, tagKeysToRemove := findRoleTagsDiff(roleTagsFromSpec(tags), role.Tags)
+	if len(tagsToPut) > 0 {
+		if _, err = a.iamClient.tagIamRole(ctx, roleName, tagsToPut); err != nil {
+			return isChanged, err
+		}
+		isChanged = true
+	}
+	if len(tagKeysToRemove) > 0 {
+		if _, err = a.iamClient.untagIamRole(ctx, roleName, tagKeysToRemove...); err != nil {
+			return isChanged, err
+		}
+		isChanged = true
+	}
+	return isChanged, nil
+}
+
+// findRoleTagsDiff returns the tags that are missing or different in aws, and the keys of the tags
+// with the operator prefix that are not in the spec anymore
+func findRoleTagsDiff(roleTags []*iam.Tag, tagsFromAws []*iam.Tag) ([]*iam.Tag, []string) {
+	awsTags := map[string]string{}
+	for _, tag := range tagsFromAws {
+		awsTags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+	specTags := map[string]bool{}
+	tagsToPut := []*iam.Tag{}
+	for _, tag := range roleTags {
+		specTags[aws.StringValue(tag.Key)] = true
+		if val, found := awsTags[aws.StringValue(tag.Key)]; !found || val != aws.StringValue(tag.Value) {
+			tagsToPut = append(tagsToPut, tag)
+		}
+	}
+	tagKeysToRemove := []string{}
+	for key := range awsTags {
+		if strings.HasPrefix(key, config.TagPrefix()) && !specTags[key] {
+			tagKeysToRemove = append(tagKeysToRemove, key)
+		}
+	}
+	sort.Strings(tagKeysToRemove)
+	return tagsToPut, tagKeysToRemove
+}
+
+func managedPolicyArns(bucketSpec *s3operatorv1.S3BucketSpec) []string {
+	if bucketSpec.IamRole == nil {
+		return nil
+	}
+	return bucketSpec.IamRole.ManagedPolicyArns
+}
+
+// deleteBucketRole tears down the role of the bucket, its inline policies are deleted, its managed policies
+// are detached and it is removed from its instance profiles before the role itself is deleted.
+// a role that was not created by the operator only loses the bucket inline policy. a role without the managed tag
+// has the name of the bucket role but was never created by the operator, it is left untouched. a role that not exists is ignored
+func (a *AwsClient) deleteBucketRole(ctx context.Context, roleName string, bucketName string, isExisting bool) error {
+	log := logr.FromContextOrDiscard(ctx)
+	if isExisting {
+		_, err := a.iamClient.deleteRolePolicy(ctx, roleName, getRolePolicyName(bucketName))
+		if err != nil && !isNoSuchEntityError(err) {
+			return err
+		}
+		log.Info("iam role was not created by the operator, it is not deleted", "role_name", roleName)
+		return nil
+	}
+	role, err := a.iamClient.getRole(ctx, roleName)
+	if err != nil {
+		if isNoSuchEntityError(err) {
+			return nil
+		}
+		return fmt.Errorf("didnt succeded to delete iam role %s: %w", roleName, err)
+	}
+	if !hasManagedTag(role.Tags) {
+		log.Info("iam role is not managed by the operator, it is not deleted", "role_name", roleName)
+		return nil
+	}
+	err = a.cleanupRole(ctx, roleName)
+	if err == nil {
+		_, err = a.iamClient.deleteIamRole(ctx, roleName)
+	}
+	if err != nil && !isNoSuchEntityError(err) {
+		return fmt.Errorf("didnt succeded to delete iam role %s: %w", roleName, err)
+	}
+	return nil
+}
+
+// cleanupRole removes everything that iam requires to remove before a role can be deleted,
+// it is called only for a role that has the managed tag
+func (a *AwsClient) cleanupRole(ctx context.Context, roleName string) error {
+	policyNames, err := a.iamClient.listRolePolicies(ctx, roleName)
+	if err != nil {
+		return err
+	}
+	for _, policyName := range policyNames {
+		if _, err = a.iamClient.deleteRolePolicy(ctx, roleName, policyName); err != nil && !isNoSuchEntityError(err) {
+			return err
+		}
+	}
+	attachedPolicyArns, err := a.iamClient.listAttachedRolePolicies(ctx, roleName)
+	if err != nil {
+		return err
+	}
+	for _, policyArn := range attachedPolicyArns {
+		if _, err = a.iamClient.detachRolePolicy(ctx, roleName, policyArn); err != nil && !isNoSuchEntityError(err) {
+			return err
+		}
+	}
+	instanceProfileNames, err := a.iamClient.listInstanceProfilesForRole(ctx, roleName)
+	if err != nil {
+		return err
+	}
+	for _, instanceProfileName := range instanceProfileNames {
+		if _, err = a.iamClient.removeRoleFromInstanceProfile(ctx, roleName, instanceProfileName); err != nil && !isNoSuchEntityError(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func isNoSuchEntityError(err error) bool {
+	awsErr, isAwsErr := err.(awserr.Error)
+	return isAwsErr && awsErr.Code() == iam.ErrCodeNoSuchEntityException
+}
+
+// isExistingRole is true when the bucket uses a role that was not created by the operator
+func isExistingRole(bucketSpec *s3operatorv1.S3BucketSpec) bool {
+	return bucketSpec.IamRole != nil && bucketSpec.IamRole.Arn != ""
+}
+
+// roleNameMaxLength is the max length of an iam role name
+const roleNameMaxLength = 64
+
+// roleNameFields are the fields that the role name template can use
+type roleNameFields struct {
+	Cluster   string
+	Namespace string
+	Bucket    string
+}
+
+// GetRoleName returns the name of the iam role of the bucket, the name that was persisted in the status
+// is kept so a change of the template never orphans an existing role. only the name of a role that was
+// created by the operator is persisted, the name of an existing role always comes from its arn
+func (a *AwsClient) GetRoleName(s3Bucket *s3operatorv1.S3Bucket) (string, error) {
+	if isExistingRole(&s3Bucket.Spec) {
+		roleArn, err := arn.Parse(s3Bucket.Spec.IamRole.Arn)
+		if err != nil {
+			return "", err
+		}
+		return roleArn.Resource[strings.LastIndex(roleArn.Resource, "/")+1:], nil
+	}
+	if s3Bucket.Status.IamRoleName != "" {
+		return s3Bucket.Status.IamRoleName, nil
+	}
+	return buildRoleName(config.RoleNameTemplate(), roleNameFields{
+		Cluster:   config.ClusterName(),
+		Namespace: s3Bucket.Namespace,
+		Bucket:    s3Bucket.Name,
+	})
+}
+
+// buildRoleName executes the role name template, a name that is too long is truncated
+// and ends with a hash of the full name so it stays unique and deterministic
+func buildRoleName(nameTemplate *template.Template, fields roleNameFields) (string, error) {
+	var name strings.Builder
+	if err := nameTemplate.Execute(&name, fields); err != nil {
+		return "", err
+	}
+	roleName := name.String()
+	if roleName == "" {
+		return "", errorkind.New(errorkind.Validation, "role name template returned an empty name")
+	}
+	if len(roleName) <= roleNameMaxLength {
+		return roleName, nil
+	}
+	hash := sha256.Sum256([]byte(roleName))
+	suffix := "-" + hex.EncodeToString(hash[:])[:8]
+	return roleName[:roleNameMaxLength-len(suffix)] + suffix, nil
+}
@@ -0,0 +1,200 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"text/template"
+
+	s3operatorv1 "github.com/PayU/K8s-S3-Operator/api/v1"
+	"github.com/PayU/K8s-S3-Operator/controllers/errorkind"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/go-logr/logr"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestBuildRoleNameTruncatesWithHash(t *testing.T) {
+	g := NewWithT(t)
+	nameTemplate := template.Must(template.New("roleName").Parse("{{.Cluster}}-{{.Namespace}}-{{.Bucket}}"))
+
+	roleName, err := buildRoleName(nameTemplate, roleNameFields{Cluster: "prod", Namespace: "team-a", Bucket: "bucket"})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(roleName).To(Equal("prod-team-a-bucket"))
+
+	longBucket := strings.Repeat("b", 63)
+	roleName, err = buildRoleName(nameTemplate, roleNameFields{Cluster: "prod", Namespace: "team-a", Bucket: longBucket})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(roleName).To(HaveLen(roleNameMaxLength))
+	g.Expect(roleName).To(HavePrefix("prod-team-a-bbb"))
+	sameRoleName, _ := buildRoleName(nameTemplate, roleNameFields{Cluster: "prod", Namespace: "team-a", Bucket: longBucket})
+	g.Expect(sameRoleName).To(Equal(roleName))
+	otherRoleName, _ := buildRoleName(nameTemplate, roleNameFields{Cluster: "prod", Namespace: "team-b", Bucket: longBucket})
+	g.Expect(otherRoleName).NotTo(Equal(roleName))
+
+	_, err = buildRoleName(template.Must(template.New("roleName").Parse("")), roleNameFields{})
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestGetRoleNameKeepsPersistedName(t *testing.T) {
+	g := NewWithT(t)
+	awsClient := &AwsClient{}
+	s3Bucket := &s3operatorv1.S3Bucket{ObjectMeta: metav1.ObjectMeta{Name: "bucket", Namespace: "team-a"}}
+
+	g.Expect(awsClient.GetRoleName(s3Bucket)).To(Equal("bucketIAM-ROLE-S3Operator"))
+	s3Bucket.Status.IamRoleName = "old-template-name"
+	g.Expect(awsClient.GetRoleName(s3Bucket)).To(Equal("old-template-name"))
+}
+
+func TestExistingRoleIsUsedAsIs(t *testing.T) {
+	g := NewWithT(t)
+	awsClient := &AwsClient{partition: "aws", accountId: "111122223333"}
+	s3Bucket := &s3operatorv1.S3Bucket{ObjectMeta: metav1.ObjectMeta{Name: "bucket", Namespace: "team-a"}}
+	s3Bucket.Spec.IamRole = &s3operatorv1.IamRoleSpec{Arn: "arn:aws:iam::444455556666:role/workloads/orders-service"}
+
+	g.Expect(awsClient.GetRoleName(s3Bucket)).To(Equal("orders-service"))
+	g.Expect(awsClient.GetRoleArn(s3Bucket)).To(Equal(s3Bucket.Spec.IamRole.Arn))
+	g.Expect(validateIamRole(&s3Bucket.Spec)).To(Succeed())
+
+	s3Bucket.Spec.IamRole.ManagedPolicyArns = []string{"arn:aws:iam::aws:policy/AmazonSQSFullAccess"}
+	g.Expect(validateIamRole(&s3Bucket.Spec)).NotTo(Succeed())
+}
+
+func TestFindRoleTagsDiff(t *testing.T) {
+	g := NewWithT(t)
+	tagsFromAws := []*iam.Tag{
+		{Key: aws.String("createdBy"), Value: aws.String("s3Operator")},
+		{Key: aws.String("s3.operator/team"), Value: aws.String("payments")},
+		{Key: aws.String("s3.operator/removed"), Value: aws.String("x")},
+		{Key: aws.String("owner"), Value: aws.String("someone-else")},
+	}
+
+	tagsToPut, tagKeysToRemove := findRoleTagsDiff(roleTagsFromSpec(map[string]string{"team": "payments", "cost-center": "42"}), tagsFromAws)
+	g.Expect(tagsToPut).To(ConsistOf(&iam.Tag{Key: aws.String("s3.operator/cost-center"), Value: aws.String("42")}))
+	g.Expect(tagKeysToRemove).To(Equal([]string{"s3.operator/removed"}))
+
+	tagsToPut, tagKeysToRemove = findRoleTagsDiff(roleTagsFromSpec(map[string]string{"team": "payments", "removed": "x"}), tagsFromAws)
+	g.Expect(tagsToPut).To(BeEmpty())
+	g.Expect(tagKeysToRemove).To(BeEmpty())
+}
+
+func TestDeleteBucketRoleKeepsRoleWithoutManagedTag(t *testing.T) {
+	g := NewWithT(t)
+	ctx := logr.NewContext(context.Background(), logr.Discard())
+	roleTags := ""
+	actions := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		g.Expect(r.ParseForm()).To(Succeed())
+		actions = append(actions, r.Form.Get("Action"))
+		if r.Form.Get("Action") == "GetRole" {
+			fmt.Fprintf(w, "<GetRoleResponse><GetRoleResult><Role><RoleName>bucket-role</RoleName><Tags>%s</Tags></Role></GetRoleResult></GetRoleResponse>", roleTags)
+			return
+		}
+		fmt.Fprintf(w, "<%sResponse></%sResponse>", r.Form.Get("Action"), r.Form.Get("Action"))
+	}))
+	defer server.Close()
+	ses := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("eu-central-1"),
+		Endpoint:    aws.String(server.URL),
+		Credentials: credentials.AnonymousCredentials,
+	}))
+	awsClient := &AwsClient{iamClient: &IamClient{IamClient: iam.New(ses)}}
+
+	g.Expect(awsClient.deleteBucketRole(ctx, "bucket-role", "bucket", false)).To(Succeed())
+	g.Expect(actions).To(Equal([]string{"GetRole"}))
+
+	actions = []string{}
+	roleTags = "<member><Key>createdBy</Key><Value>s3Operator</Value></member>"
+	g.Expect(awsClient.deleteBucketRole(ctx, "bucket-role", "bucket", false)).To(Succeed())
+	g.Expect(actions).To(Equal([]string{"GetRole", "ListRolePolicies", "ListAttachedRolePolicies", "ListInstanceProfilesForRole", "DeleteRole"}))
+}
+
+func TestRoleWithoutManagedTagIsNotChanged(t *testing.T) {
+	g := NewWithT(t)
+	ctx := logr.NewContext(context.Background(), logr.Discard())
+	actions := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		g.Expect(r.ParseForm()).To(Succeed())
+		actions = append(actions, r.Form.Get("Action"))
+		if r.Form.Get("Action") == "GetRole" {
+			fmt.Fprint(w, "<GetRoleResponse><GetRoleResult><Role><RoleName>orders-service</RoleName>"+
+				"<Arn>arn:aws:iam::111122223333:role/workloads/orders-service</Arn></Role></GetRoleResult></GetRoleResponse>")
+			return
+		}
+		fmt.Fprintf(w, "<%sResponse></%sResponse>", r.Form.Get("Action"), r.Form.Get("Action"))
+	}))
+	defer server.Close()
+	logger := logr.Discard()
+	awsClient := NewAwsClientFromSession(&logger, newTestSession(server), nil, record.NewFakeRecorder(10),
+		Identity{Partition: "aws", AccountId: "111122223333", OidcIssuer: "oidc.eks.eu-central-1.amazonaws.com/id/EXAMPLE"})
+
+	_, trustPolicyErr := awsClient.updateRoleTrustPolicy(ctx, "orders-service", "team-a", "app")
+	_, managedPoliciesErr := awsClient.updateRoleManagedPolicies(ctx, "orders-service", []string{"arn:aws:iam::aws:policy/AmazonSQSFullAccess"})
+	_, settingsErr := awsClient.updateRoleSettings(ctx, "orders-service", map[string]string{"team": "payments"})
+	for _, err := range []error{trustPolicyErr, managedPoliciesErr, settingsErr} {
+		kind, isKnown := errorkind.Of(err)
+		g.Expect(isKnown).To(BeTrue())
+		g.Expect(kind).To(Equal(errorkind.Conflict))
+	}
+	g.Expect(actions).To(Equal([]string{"GetRole", "GetRole", "GetRole"}))
+
+	// the name of an existing role is never persisted, it always comes from the arn of the spec
+	actions = []string{}
+	s3Bucket := &s3operatorv1.S3Bucket{ObjectMeta: metav1.ObjectMeta{Name: "bucket", Namespace: "team-a"}}
+	s3Bucket.Spec.IamRole = &s3operatorv1.IamRoleSpec{Arn: "arn:aws:iam::111122223333:role/workloads/orders-service"}
+	g.Expect(awsClient.createBucketRole(ctx, s3Bucket)).To(Equal("orders-service"))
+	g.Expect(s3Bucket.Status.IamRoleName).To(BeEmpty())
+	g.Expect(s3Bucket.Status.IamRoleArn).To(Equal(s3Bucket.Spec.IamRole.Arn))
+	g.Expect(actions).To(Equal([]string{"GetRole"}))
+}
+
+func TestCreateMissingRole(t *testing.T) {
+	g := NewWithT(t)
+	ctx := logr.NewContext(context.Background(), logr.Discard())
+	isRoleMissing := false
+	actions := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		g.Expect(r.ParseForm()).To(Succeed())
+		action := r.Form.Get("Action")
+		actions = append(actions, action)
+		switch {
+		case action == "GetRole" && isRoleMissing:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, "<ErrorResponse><Error><Code>NoSuchEntity</Code><Message>role not found</Message></Error></ErrorResponse>")
+		case action == "GetRole" || action == "CreateRole":
+			isRoleMissing = false
+			fmt.Fprintf(w, "<%sResponse><%sResult><Role><RoleName>bucket-role</RoleName>"+
+				"<Arn>arn:aws:iam::111122223333:role/s3-operator/bucket-role</Arn>"+
+				"<Tags><member><Key>createdBy</Key><Value>s3Operator</Value></member></Tags></Role></%sResult></%sResponse>", action, action, action, action)
+		default:
+			fmt.Fprintf(w, "<%sResponse></%sResponse>", action, action)
+		}
+	}))
+	defer server.Close()
+	logger := logr.Discard()
+	awsClient := NewAwsClientFromSession(&logger, newTestSession(server), nil, record.NewFakeRecorder(10),
+		Identity{Partition: "aws", AccountId: "111122223333", OidcIssuer: "oidc.eks.eu-central-1.amazonaws.com/id/EXAMPLE"})
+	s3Bucket := &s3operatorv1.S3Bucket{ObjectMeta: metav1.ObjectMeta{Name: "bucket", Namespace: "team-a"}}
+	s3Bucket.Status.IamRoleName = "bucket-role"
+
+	isCreated, err := awsClient.createMissingRole(ctx, s3Bucket, "bucket-role")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(isCreated).To(BeFalse())
+	g.Expect(actions).To(Equal([]string{"GetRole"}))
+
+	// the role of a bucket that was created before the role names were valid was never created
+	actions = []string{}
+	isRoleMissing = true
+	isCreated, err = awsClient.createMissingRole(ctx, s3Bucket, "bucket-role")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(isCreated).To(BeTrue())
+	g.Expect(actions).To(Equal([]string{"GetRole", "CreateRole", "GetRole", "ListAttachedRolePolicies"}))
+	g.Expect(s3Bucket.Status.IamRoleArn).To(Equal("arn:aws:iam::111122223333:role/s3-operator/bucket-role"))
+}
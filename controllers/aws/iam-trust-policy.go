@@ -0,0 +1,103 @@
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/PayU/K8s-S3-Operator/controllers/config"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/go-logr/logr"
+)
+
+// getOidcIssuer returns the oidc issuer of the cluster without the scheme, the configured issuer is used
+// when set, otherwise it is discovered from the eks cluster. an error is returned when it is unknown,
+// the trust policies of the bucket roles can not be built without it
+func getOidcIssuer(Log *logr.Logger, ses *session.Session) (string, error) {
+	if config.OidcIssuer() != "" {
+		return config.OidcIssuer(), nil
+	}
+	if config.ClusterName() == "" {
+		return "", errors.New("oidc issuer of the cluster is unknown, set OIDC_ISSUER or CLUSTER_NAME")
+	}
+	eksClient := eks.New(ses)
+	res, err := eksClient.DescribeCluster(&eks.DescribeClusterInput{Name: aws.String(config.ClusterName())})
+	if err != nil {
+		Log.Error(err, "didnt succeded to discover oidc issuer", "cluster_name", config.ClusterName())
+		return "", fmt.Errorf("didnt succeded to discover oidc issuer of cluster %s, set OIDC_ISSUER or allow eks:DescribeCluster: %w", config.ClusterName(), err)
+	}
+	if res.Cluster == nil || res.Cluster.Identity == nil || res.Cluster.Identity.Oidc == nil {
+		return "", fmt.Errorf("cluster %s has no oidc issuer, set OIDC_ISSUER", config.ClusterName())
+	}
+	issuer := strings.TrimPrefix(aws.StringValue(res.Cluster.Identity.Oidc.Issuer), "https://")
+	Log.Info("discovered oidc issuer", "cluster_name", config.ClusterName(), "issuer", issuer)
+	return issuer, nil
+}
+
+// buildTrustPolicy allows only the given service account to assume the role, through the oidc provider of the cluster
+func buildTrustPolicy(oidcProviderArn string, oidcIssuer string, namespace string, serviceAccount string) map[string]interface{} {
+	return map[string]interface{}{
+		"Version": "2012-10-17",
+		"Statement": []map[string]interface{}{
+			{
+				"Effect":    "Allow",
+				"Principal": map[string]interface{}{"Federated": oidcProviderArn},
+				"Action":    "sts:AssumeRoleWithWebIdentity",
+				"Condition": map[string]interface{}{
+					"StringEquals": map[string]interface{}{
+						oidcIssuer + ":sub": "system:serviceaccount:" + namespace + ":" + serviceAccount,
+						oidcIssuer + ":aud": "sts.amazonaws.com",
+					},
+				},
+			},
+		},
+	}
+}
+
+// trustPolicyDocument returns the trust policy of the bucket role for the service account
+func (a *AwsClient) trustPolicyDocument(ctx context.Context, namespace string, serviceAccount string) (string, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	if a.oidcIssuer == "" {
+		return "", errors.New("oidc issuer of the cluster is unknown, set OIDC_ISSUER or CLUSTER_NAME")
+	}
+	if a.accountId == "" {
+		return "", errors.New("aws account id is unknown, set AWS_ACCOUNT_ID or allow sts:GetCallerIdentity")
+	}
+	trustPolicy, err := json.Marshal(buildTrustPolicy(a.oidcProviderArn(), a.oidcIssuer, namespace, serviceAccount))
+	if err != nil {
+		log.Error(err, "error in TrustPolicyDocument in Marshal")
+		return "", err
+	}
+	return string(trustPolicy), nil
+}
+
+// updateRoleTrustPolicy binds the role to the service account when its trust policy in aws differs,
+// the returned bool is true when the trust policy was changed
+func (a *AwsClient) updateRoleTrustPolicy(ctx context.Context, roleName string, namespace string, serviceAccount string) (bool, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	log.V(1).Info("UpdateRoleTrustPolicy function", "role_name", roleName)
+	trustPolicy, err := a.trustPolicyDocument(ctx, namespace, serviceAccount)
+	if err != nil {
+		return false, err
+	}
+	role, err := a.getManagedRole(ctx, roleName)
+	if err != nil {
+		return false, err
+	}
+	currentTrustPolicy, err := url.QueryUnescape(aws.StringValue(role.AssumeRolePolicyDocument))
+	if err != nil {
+		log.Error(err, "error to decode role trust policy", "role_name", roleName)
+		return false, err
+	}
+	if isPolicyEqual(currentTrustPolicy, trustPolicy) {
+		log.V(1).Info("no trust policy to update", "role_name", roleName)
+		return false, nil
+	}
+	_, err = a.iamClient.updateAssumeRolePolicy(ctx, roleName, trustPolicy)
+	return true, err
+}
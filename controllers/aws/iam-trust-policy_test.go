@@ -0,0 +1,45 @@
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/gomega"
+)
+
+func TestBuildTrustPolicyIsBoundToServiceAccount(t *testing.T) {
+	g := NewWithT(t)
+	issuer := "oidc.eks.eu-central-1.amazonaws.com/id/EXAMPLED539D4633E53DE1B71EXAMPLE"
+	providerArn := "arn:aws:iam::111122223333:oidc-provider/" + issuer
+
+	policy, err := json.Marshal(buildTrustPolicy(providerArn, issuer, "team-a", "uploader"))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(policy)).To(ContainSubstring(`"Federated":"` + providerArn + `"`))
+	g.Expect(string(policy)).To(ContainSubstring(`"sts:AssumeRoleWithWebIdentity"`))
+	g.Expect(string(policy)).To(ContainSubstring(`"` + issuer + `:sub":"system:serviceaccount:team-a:uploader"`))
+	g.Expect(string(policy)).To(ContainSubstring(`"` + issuer + `:aud":"sts.amazonaws.com"`))
+
+	otherPolicy, err := json.Marshal(buildTrustPolicy(providerArn, issuer, "team-a", "downloader"))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(isPolicyEqual(string(policy), string(otherPolicy))).To(BeFalse())
+}
+
+func TestTrustPolicyDocumentRequiresOidcIssuer(t *testing.T) {
+	g := NewWithT(t)
+	ctx := logr.NewContext(context.Background(), logr.Discard())
+	awsClient := &AwsClient{}
+
+	_, err := awsClient.trustPolicyDocument(ctx, "team-a", "uploader")
+	g.Expect(err).To(MatchError(ContainSubstring("oidc issuer")))
+}
+
+func TestOidcIssuerIsRequired(t *testing.T) {
+	g := NewWithT(t)
+	logger := logr.Discard()
+
+	// neither OIDC_ISSUER nor CLUSTER_NAME is set, the issuer can not be discovered
+	_, err := getOidcIssuer(&logger, nil)
+	g.Expect(err).To(MatchError(ContainSubstring("set OIDC_ISSUER or CLUSTER_NAME")))
+}
@@ -0,0 +1,140 @@
+package aws
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/PayU/K8s-S3-Operator/controllers/config"
+	"github.com/PayU/K8s-S3-Operator/controllers/errorkind"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// minRateFraction of the configured rate is kept however much the service throttles
+	minRateFraction = 0.1
+	// rateRecoveryFraction of the configured rate is given back after every request that succeeded
+	rateRecoveryFraction = 0.02
+	// rateDecreaseInterval groups the throttling errors of concurrent requests into a single decrease
+	rateDecreaseInterval = time.Second
+
+	minThrottleDelay = 500 * time.Millisecond
+	maxThrottleDelay = 20 * time.Second
+)
+
+// serviceLimiter is a token bucket that every attempt of a request to an aws service waits on.
+// its rate is halved when the service throttles and recovers slowly while requests succeed
+type serviceLimiter struct {
+	limiter      *rate.Limiter
+	maxRate      rate.Limit
+	mu           sync.Mutex
+	lastDecrease time.Time
+}
+
+func newServiceLimiter(service string) *serviceLimiter {
+	maxRate := rate.Limit(config.AwsRateLimit(service))
+	return &serviceLimiter{limiter: rate.NewLimiter(maxRate, config.AwsRateBurst(service)), maxRate: maxRate}
+}
+
+// serviceLimiters are shared by the clients of all the reconciles, so the limits are global to the operator
+var serviceLimiters = map[string]*serviceLimiter{
+	s3.ServiceName:  newServiceLimiter(s3.ServiceName),
+	iam.ServiceName: newServiceLimiter(iam.ServiceName),
+	sts.ServiceName: newServiceLimiter(sts.ServiceName),
+}
+
+// limitRequests adds the limiter of the service to the handlers of its client
+func limitRequests(handlers *request.Handlers, service string) {
+	limiter := serviceLimiters[service]
+	// the token is taken after the signing, the signer resets the error of the request
+	handlers.Sign.PushBack(limiter.wait)
+	handlers.Retry.PushBack(limiter.decreaseOnThrottle)
+	handlers.Complete.PushBack(limiter.increaseOnSuccess)
+}
+
+// wait is a sign handler, it blocks the attempt until there is a token or the context of the request is done
+func (l *serviceLimiter) wait(r *request.Request) {
+	if r.Error != nil {
+		return
+	}
+	if err := l.limiter.Wait(r.Context()); err != nil {
+		r.Error = awserr.New(request.CanceledErrorCode, "request was not sent, waiting for the rate limit of the service failed", err)
+	}
+}
+
+// decreaseOnThrottle is a retry handler, it halves the rate of the service when the attempt was throttled
+func (l *serviceLimiter) decreaseOnThrottle(r *request.Request) {
+	if !isThrottleError(r) {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if time.Since(l.lastDecrease) < rateDecreaseInterval {
+		return
+	}
+	l.lastDecrease = time.Now()
+	newRate := l.limiter.Limit() / 2
+	if minRate := l.maxRate * minRateFraction; newRate < minRate {
+		newRate = minRate
+	}
+	l.limiter.SetLimit(newRate)
+}
+
+// increaseOnSuccess is a complete handler, it moves the rate of the service back towards the configured rate
+func (l *serviceLimiter) increaseOnSuccess(r *request.Request) {
+	if r.Error != nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if currentRate := l.limiter.Limit(); currentRate < l.maxRate {
+		newRate := currentRate + l.maxRate*rateRecoveryFraction
+		if newRate > l.maxRate {
+			newRate = l.maxRate
+		}
+		l.limiter.SetLimit(newRate)
+	}
+}
+
+func isThrottleError(r *request.Request) bool {
+	return r.IsErrorThrottle() || ErrorKind(r.Error) == errorkind.Throttling
+}
+
+// throttlingRetryer retries a throttled request after a random delay up to an exponential bound,
+// so the requests that were throttled together are not retried together. other errors are retried
+// like the default retryer
+type throttlingRetryer struct {
+	client.DefaultRetryer
+}
+
+func newThrottlingRetryer() throttlingRetryer {
+	return throttlingRetryer{client.DefaultRetryer{
+		NumMaxRetries:    config.AwsMaxRetries(),
+		MinThrottleDelay: minThrottleDelay,
+		MaxThrottleDelay: maxThrottleDelay,
+	}}
+}
+
+func (r throttlingRetryer) ShouldRetry(req *request.Request) bool {
+	if isThrottleError(req) {
+		return true
+	}
+	return r.DefaultRetryer.ShouldRetry(req)
+}
+
+func (r throttlingRetryer) RetryRules(req *request.Request) time.Duration {
+	if !isThrottleError(req) {
+		return r.DefaultRetryer.RetryRules(req)
+	}
+	maxDelay := r.MaxThrottleDelay
+	if req.RetryCount < 16 && r.MinThrottleDelay<<req.RetryCount < maxDelay {
+		maxDelay = r.MinThrottleDelay << req.RetryCount
+	}
+	return time.Duration(rand.Int63n(int64(maxDelay)))
+}
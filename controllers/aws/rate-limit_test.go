@@ -0,0 +1,72 @@
+package aws
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	. "github.com/onsi/gomega"
+	"golang.org/x/time/rate"
+)
+
+func TestServiceLimiterAdaptsToThrottling(t *testing.T) {
+	g := NewWithT(t)
+	l := &serviceLimiter{limiter: rate.NewLimiter(10, 10), maxRate: 10}
+	throttled := &request.Request{Error: awserr.New("SlowDown", "please reduce your request rate", nil)}
+
+	l.decreaseOnThrottle(throttled)
+	g.Expect(l.limiter.Limit()).To(Equal(rate.Limit(5)))
+	// throttling of concurrent requests is a single decrease
+	l.decreaseOnThrottle(throttled)
+	g.Expect(l.limiter.Limit()).To(Equal(rate.Limit(5)))
+
+	for i := 0; i < 10; i++ {
+		l.lastDecrease = time.Time{}
+		l.decreaseOnThrottle(throttled)
+	}
+	g.Expect(l.limiter.Limit()).To(Equal(rate.Limit(1)))
+
+	l.decreaseOnThrottle(&request.Request{Error: awserr.New("AccessDenied", "access denied", nil)})
+	g.Expect(l.limiter.Limit()).To(Equal(rate.Limit(1)))
+
+	for i := 0; i < 100; i++ {
+		l.increaseOnSuccess(&request.Request{})
+	}
+	g.Expect(l.limiter.Limit()).To(Equal(rate.Limit(10)))
+}
+
+func TestServiceLimiterWaitStopsWithContext(t *testing.T) {
+	g := NewWithT(t)
+	l := &serviceLimiter{limiter: rate.NewLimiter(0.001, 1), maxRate: 0.001}
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &request.Request{HTTPRequest: httptest.NewRequest("PUT", "https://bucket.s3.amazonaws.com", nil)}
+	r.SetContext(ctx)
+
+	l.wait(r)
+	g.Expect(r.Error).NotTo(HaveOccurred())
+
+	cancel()
+	l.wait(r)
+	g.Expect(r.Error).To(HaveOccurred())
+	g.Expect(r.Error.(awserr.Error).Code()).To(Equal(request.CanceledErrorCode))
+}
+
+func TestThrottlingRetryerDelayIsJittered(t *testing.T) {
+	g := NewWithT(t)
+	retryer := newThrottlingRetryer()
+	r := &request.Request{Error: awserr.New("Throttling", "rate exceeded", nil)}
+
+	g.Expect(retryer.ShouldRetry(r)).To(BeTrue())
+	for retryCount := 0; retryCount < 20; retryCount++ {
+		r.RetryCount = retryCount
+		delay := retryer.RetryRules(r)
+		g.Expect(delay).To(BeNumerically(">=", 0))
+		g.Expect(delay).To(BeNumerically("<", maxThrottleDelay))
+		if retryCount == 0 {
+			g.Expect(delay).To(BeNumerically("<", minThrottleDelay))
+		}
+	}
+}
@@ -1,133 +1,370 @@
 package aws
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"net/url"
 	"regexp"
 
 	s3operatorv1 "github.com/PayU/K8s-S3-Operator/api/v1"
 	"github.com/PayU/K8s-S3-Operator/controllers/config"
+	"github.com/PayU/K8s-S3-Operator/controllers/dryrun"
+	"github.com/PayU/K8s-S3-Operator/controllers/errorkind"
 	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
 
-	"github.com/aws/aws-sdk-go/service/iam"
 	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 )
 
+const errCodeNoSuchBucketPolicy = "NoSuchBucketPolicy"
+const errCodeAccessDenied = "AccessDenied"
+
 func (a *AwsClient) ValidateBucketName(name string) error {
 	if len(name) > 4 && name[:4] == "xn--" {
-		return errors.New("bucket name can't start with xn--")
+		return errorkind.New(errorkind.Validation, "bucket name can't start with xn--")
 	}
 	if len(name) > 8 && name[len(name)-8:] == "-s3alias" {
-		return errors.New("bucket name can't end with -s3alias")
+		return errorkind.New(errorkind.Validation, "bucket name can't end with -s3alias")
 	}
 	match, _ := regexp.MatchString("^[a-zA-Z][a-zA-Z0-9\\-]+[a-zA-Z0-9]$", name)
 	if !match {
 
-		return errors.New("bucket name not mutch pattern: '^[a-zA-Z][a-zA-Z0-9\\-]+[a-zA-Z0-9]$' ")
+		return errorkind.New(errorkind.Validation, "bucket name not mutch pattern: '^[a-zA-Z][a-zA-Z0-9\\-]+[a-zA-Z0-9]$' ")
 	}
 	return nil
 }
 
-func (a *AwsClient) HandleBucketCreation(bucketSpec *s3operatorv1.S3BucketSpec, bucketName string, namespace string) error {
-
-	bucketInput := a.createBucketInput(bucketName, config.Region())
-	_, err := a.createBucket(*bucketInput)
-	if err != nil {
-		a.Log.Error(err, "got error in create bucket function")
-		return err
+// HandleBucketCreation runs the creation steps in order, starting from the step that did not finish in a previous
+// reconcile. the creation is rolled back when a step fails more times than the operator limit, and it is not
+// started again until the spec of the bucket is changed
+func (a *AwsClient) HandleBucketCreation(ctx context.Context, s3Bucket *s3operatorv1.S3Bucket) error {
+	log := logr.FromContextOrDiscard(ctx)
+	status := &s3Bucket.Status
+	if status.ProvisioningStep == "" {
+		if condition := meta.FindStatusCondition(status.Conditions, s3operatorv1.ConditionBucketCreated); condition != nil &&
+			condition.Reason == s3operatorv1.ReasonRolledBack && condition.ObservedGeneration == s3Bucket.Generation {
+			return errorkind.Errorf(errorkind.Validation, "%s, the spec must be changed to create the bucket again", condition.Message)
+		}
+		// validate before creating the bucket, so a forbidden public access never leaves an open bucket
+		if _, err := publicAccessBlockFromSpec(s3Bucket.Spec.PublicAccess, config.ForbidPublicAccess()); err != nil {
+			status.SetCondition(s3operatorv1.ConditionPublicAccessApplied, s3Bucket.Generation, err)
+			return err
+		}
+		if err := validateIamRole(&s3Bucket.Spec); err != nil {
+			status.SetCondition(s3operatorv1.ConditionIAMRoleReady, s3Bucket.Generation, err)
+			return err
+		}
 	}
-	a.putBucketTagging(bucketName, &bucketSpec.Tags)
-	roleName := GetRoleName(bucketName)
-	tag := config.DefaultTag()
-	a.iamClient.createIamRole(roleName, &iam.Tag{Key: tag.Key, Value: tag.Value}, a.Log)
-
-	a.putBucketPolicy(bucketName, roleName)
-	if bucketSpec.Encryption {
-		a.putBucketEncrypt(bucketName)
+	if plan := dryrun.FromContext(ctx); plan != nil {
+		return a.planBucketCreation(s3Bucket, plan)
+	}
+	if status.ProvisioningStep != "" && status.ProvisioningFailures >= config.CreationMaxFailures() {
+		return a.rollbackBucketCreation(ctx, s3Bucket)
 	}
-	a.Log.Info("S3 bucket creation process finished successfully", "region", config.Region())
+	for stepIndex := getCreationStepIndex(status.ProvisioningStep); stepIndex < len(creationSteps); stepIndex++ {
+		step := creationSteps[stepIndex]
+		if status.ProvisioningStep != step.name {
+			status.ProvisioningStep = step.name
+			status.ProvisioningFailures = 0
+			// the step is persisted before it runs, so a reconcile that stops in the middle of the step
+			// is resumed from it, and a bucket that was just created is not taken for an existing bucket
+			if err := a.k8sClient.Status().Update(ctx, s3Bucket); err != nil {
+				log.Error(err, "didnt succeded to persist bucket creation step", "provisioning_step", step.name)
+				return fmt.Errorf("bucket creation step %s was not persisted: %w", step.name, err)
+			}
+		}
+		log.V(1).Info("running bucket creation step", "provisioning_step", step.name)
+		if err := step.run(a, ctx, s3Bucket); err != nil {
+			if ctx.Err() != nil {
+				// the reconcile was cancelled or timed out, the step is resumed by the next reconcile
+				return fmt.Errorf("bucket creation step %s was interrupted: %w", step.name, err)
+			}
+			status.ProvisioningFailures++
+			log.Error(err, "bucket creation step failed", "provisioning_step", step.name, "provisioning_failures", status.ProvisioningFailures)
+			a.Recorder.Eventf(s3Bucket, corev1.EventTypeWarning, s3operatorv1.EventCreationStepFailed,
+				"bucket creation step %s failed %d times: %v", step.name, status.ProvisioningFailures, err)
+			if status.ProvisioningFailures >= config.CreationMaxFailures() {
+				return a.rollbackBucketCreation(ctx, s3Bucket)
+			}
+			return fmt.Errorf("bucket creation step %s failed: %w", step.name, err)
+		}
+	}
+	status.ProvisioningStep = ""
+	status.ProvisioningFailures = 0
+	log.Info("S3 bucket creation process finished successfully", "region", config.Region())
 	return nil
-
 }
 
-func (a *AwsClient) HandleBucketDeletion(bucketToDelete string) (bool, error) {
-	a.Log.Info(" Start to delete s3 bucket from aws")
-	isBucketExists, err := a.IsBucketExists(bucketToDelete)
+// HandleBucketDeletion applies the deletion policy of the bucket, the returned bool is true
+// only when the bucket and the iam role were deleted from aws
+func (a *AwsClient) HandleBucketDeletion(ctx context.Context, s3Bucket *s3operatorv1.S3Bucket) (bool, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	bucketToDelete := s3Bucket.Name
+	deletionPolicy := s3Bucket.Spec.DeletionPolicy
+	if deletionPolicy == "" {
+		deletionPolicy = s3operatorv1.DeletionPolicy(config.DefaultDeletionPolicy())
+	}
+	log.Info(" Start to delete s3 bucket from aws", "deletion_policy", deletionPolicy)
+	if deletionPolicy == s3operatorv1.DeletionPolicyOrphan {
+		log.Info("deletion policy is Orphan, bucket and iam role are left untouched")
+		return false, nil
+	}
+	roleName, err := a.GetRoleName(s3Bucket)
+	if err != nil {
+		return false, err
+	}
+	if deletionPolicy == s3operatorv1.DeletionPolicyRetain {
+		return false, a.releaseBucket(ctx, bucketToDelete, roleName, isExistingRole(&s3Bucket.Spec))
+	}
+	isBucketExists, err := a.IsBucketExists(ctx, bucketToDelete)
+	if err != nil {
+		return false, err
+	}
 	if isBucketExists {
-		isOwner, err := a.isBucketManagedByOperator(bucketToDelete)
+		isOwner, err := a.isBucketManagedByOperator(ctx, bucketToDelete)
 		if !isOwner {
+			if err == nil {
+				a.Recorder.Event(s3Bucket, corev1.EventTypeWarning, s3operatorv1.EventDeletionBlocked,
+					"bucket is not managed by the operator, it is left untouched")
+			}
 			return false, err
 		}
-		err = a.cleanupsBucketContent(bucketToDelete)
+		err = a.cleanupsBucketContent(ctx, bucketToDelete)
 		if err != nil {
-			a.Log.Error(err, "err to cleanup bucket")
+			log.Error(err, "err to cleanup bucket")
 			return false, err
 		}
-		_, err = a.deleteBucket(bucketToDelete)
+		_, err = a.deleteBucket(ctx, bucketToDelete)
 		if err != nil {
-			a.Log.Error(err, "err delete bucket")
+			log.Error(err, "err delete bucket")
 			return false, err
 		}
-		_, err = a.iamClient.deleteIamRole(GetRoleName(bucketToDelete), a.Log)
-		a.Log.Info("s3 bucket deletion from aws finished successfully")
+	} else {
+		log.Info("s3 bucket not exists in aws, continue to delete iam role")
 	}
-	return true, err
+	// the role is deleted also when the bucket is already gone, in case a previous deletion stopped in the middle
+	err = a.deleteBucketRole(ctx, roleName, bucketToDelete, isExistingRole(&s3Bucket.Spec))
+	s3Bucket.Status.SetCondition(s3operatorv1.ConditionIAMRoleDeleted, s3Bucket.Generation, err)
+	if err != nil {
+		return false, err
+	}
+	log.Info("s3 bucket deletion from aws finished successfully")
+	a.Recorder.Event(s3Bucket, corev1.EventTypeNormal, s3operatorv1.EventBucketDeleted, "bucket and iam role were deleted")
+	return true, nil
 }
 
-func (a *AwsClient) HandleBucketUpdate(bucketName string, bucketSpec *s3operatorv1.S3BucketSpec) error {
-	a.Log.V(1).Info("HandleBucketUpdate function")
-	isOwner, err := a.isBucketManagedByOperator(bucketName)
-	if isOwner {
-		_, err = a.updateBucketTags(bucketName, bucketSpec.Tags)
-	} else if err == nil {
-			err = errors.New("cant update bucket that not manage by operator")
+// releaseBucket keeps the bucket and the iam role but removes the managed tag from them,
+// so the operator will not update or delete them anymore. an existing role was never tagged by the operator, it is left untouched
+func (a *AwsClient) releaseBucket(ctx context.Context, bucketName string, roleName string, isExistingRole bool) error {
+	log := logr.FromContextOrDiscard(ctx)
+	isBucketExists, err := a.IsBucketExists(ctx, bucketName)
+	if err != nil {
+		return err
+	}
+	if isBucketExists {
+		isOwner, err := a.isBucketManagedByOperator(ctx, bucketName)
+		if !isOwner {
+			return err
+		}
+		err = a.removeManagedTag(ctx, bucketName)
+		if err != nil {
+			return err
+		}
+	}
+	if !isExistingRole {
+		// a role without the managed tag was not created by the operator, there is nothing to release
+		role, err := a.iamClient.getRole(ctx, roleName)
+		if err == nil && hasManagedTag(role.Tags) {
+			defaultTag := config.DefaultTag()
+			_, err = a.iamClient.untagIamRole(ctx, roleName, *defaultTag.Key)
+		}
+		if err != nil && !isNoSuchEntityError(err) {
+			return err
 		}
-	a.Log.Info("finish to HandleBucketUpdate")
-	return err
+	}
+	log.Info("deletion policy is Retain, bucket and iam role are no longer managed by the operator")
+	return nil
 }
 
-func (a *AwsClient) IsBucketExists(name string) (bool, error) {
-	_, err := a.s3Client.GetBucketLocation(&s3.GetBucketLocationInput{Bucket: aws.String(name)})
+// HandleBucketUpdate compares every setting of the bucket and its role with the spec and corrects it.
+// when the spec did not change since the last reconcile, a corrected setting is a drift and it is recorded
+// in the status. the fields that drifted are returned
+func (a *AwsClient) HandleBucketUpdate(ctx context.Context, s3Bucket *s3operatorv1.S3Bucket) ([]string, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	log.V(1).Info("HandleBucketUpdate function")
+	isOwner, err := a.isBucketManagedByOperator(ctx, s3Bucket.Name)
+	if !isOwner {
+		if err == nil {
+			err = errorkind.New(errorkind.Conflict, "cant update bucket that not manage by operator")
+		}
+		return nil, err
+	}
+	changedFields := []string{}
+	var isChanged bool
+	isChanged, err = a.updateBucketTags(ctx, s3Bucket.Name, s3Bucket.Spec.Tags)
+	s3Bucket.Status.SetCondition(s3operatorv1.ConditionTaggingApplied, s3Bucket.Generation, err)
+	changedFields = appendChangedField(changedFields, "tags", isChanged)
+	if isChanged {
+		a.Recorder.Event(s3Bucket, corev1.EventTypeNormal, s3operatorv1.EventTagsUpdated, "bucket tags were updated")
+	}
+	if err == nil && s3Bucket.Spec.Versioning != "" {
+		isChanged, err = a.updateBucketVersioning(ctx, s3Bucket.Name, s3Bucket.Spec.Versioning)
+		s3Bucket.Status.SetCondition(s3operatorv1.ConditionVersioningApplied, s3Bucket.Generation, err)
+		changedFields = appendChangedField(changedFields, "versioning", isChanged)
+	}
+	// lifecycle rules that were configured outside of the operator are kept, until the spec sets rules.
+	// the rules that the operator applied are removed when they are removed from the spec
+	lifecycleRules := s3Bucket.Spec.LifecycleRules
+	if err == nil && (len(lifecycleRules) > 0 || s3Bucket.Status.IsSettingManaged(s3operatorv1.ConditionLifecycleApplied)) {
+		isChanged, err = a.updateBucketLifecycle(ctx, s3Bucket.Name, lifecycleRules)
+		if err == nil && len(lifecycleRules) == 0 {
+			s3Bucket.Status.SetNotRequested(s3operatorv1.ConditionLifecycleApplied, s3Bucket.Generation)
+		} else {
+			s3Bucket.Status.SetCondition(s3operatorv1.ConditionLifecycleApplied, s3Bucket.Generation, err)
+		}
+		changedFields = appendChangedField(changedFields, "lifecycleRules", isChanged)
+	}
+	// cors is managed the same way, the configuration is removed only when the operator applied it
+	corsRules := s3Bucket.Spec.Cors
+	if err == nil && (len(corsRules) > 0 || s3Bucket.Status.IsSettingManaged(s3operatorv1.ConditionCorsApplied)) {
+		isChanged, err = a.updateBucketCors(ctx, s3Bucket.Name, corsRules)
+		if err == nil && len(corsRules) == 0 {
+			s3Bucket.Status.SetNotRequested(s3operatorv1.ConditionCorsApplied, s3Bucket.Generation)
+		} else {
+			s3Bucket.Status.SetCondition(s3operatorv1.ConditionCorsApplied, s3Bucket.Generation, err)
+		}
+		changedFields = appendChangedField(changedFields, "cors", isChanged)
+	}
+	if err == nil {
+		isChanged, err = a.updateBucketPublicAccessBlock(ctx, s3Bucket.Name, s3Bucket.Spec.PublicAccess)
+		s3Bucket.Status.SetCondition(s3operatorv1.ConditionPublicAccessApplied, s3Bucket.Generation, err)
+		changedFields = appendChangedField(changedFields, "publicAccess", isChanged)
+	}
+	if err == nil && s3Bucket.Spec.GetEncryption() != nil {
+		isChanged, err = a.updateBucketEncryption(ctx, s3Bucket.Name, s3Bucket.Spec.GetEncryption())
+		s3Bucket.Status.SetCondition(s3operatorv1.ConditionEncryptionApplied, s3Bucket.Generation, err)
+		changedFields = appendChangedField(changedFields, "encryption", isChanged)
+	}
+	var roleName string
+	if err == nil {
+		roleName, err = a.GetRoleName(s3Bucket)
+	}
+	if err == nil && !isExistingRole(&s3Bucket.Spec) {
+		s3Bucket.Status.IamRoleName = roleName
+	}
+	if err == nil {
+		err = validateIamRole(&s3Bucket.Spec)
+	}
+	if err == nil && !isExistingRole(&s3Bucket.Spec) {
+		var isCreated bool
+		isCreated, err = a.createMissingRole(ctx, s3Bucket, roleName)
+		changedFields = appendChangedField(changedFields, "role", isCreated)
+		if err == nil && !isCreated {
+			isChanged, err = a.updateRoleTrustPolicy(ctx, roleName, s3Bucket.Namespace, s3Bucket.Spec.Serviceaccount)
+			changedFields = appendChangedField(changedFields, "roleTrustPolicy", isChanged)
+		}
+		if err == nil && !isCreated {
+			isChanged, err = a.updateRoleManagedPolicies(ctx, roleName, managedPolicyArns(&s3Bucket.Spec))
+			changedFields = appendChangedField(changedFields, "roleManagedPolicies", isChanged)
+		}
+		if err == nil && !isCreated {
+			isChanged, err = a.updateRoleSettings(ctx, roleName, s3Bucket.Spec.Tags)
+			changedFields = appendChangedField(changedFields, "roleSettings", isChanged)
+		}
+		s3Bucket.Status.SetCondition(s3operatorv1.ConditionIAMRoleReady, s3Bucket.Generation, err)
+	}
+	if err == nil {
+		isChanged, err = a.updateRolePolicy(ctx, roleName, s3Bucket.Name, &s3Bucket.Spec)
+		s3Bucket.Status.SetCondition(s3operatorv1.ConditionIAMRoleReady, s3Bucket.Generation, err)
+		changedFields = appendChangedField(changedFields, "rolePolicy", isChanged)
+		if isChanged {
+			a.Recorder.Eventf(s3Bucket, corev1.EventTypeNormal, s3operatorv1.EventPolicyApplied, "inline policy of iam role %s was applied", roleName)
+		}
+	}
+	if err == nil {
+		s3Bucket.Status.IamRoleArn, err = a.GetRoleArn(s3Bucket)
+	}
+	if err == nil {
+		isChanged, err = a.updateBucketPolicy(ctx, s3Bucket.Name, s3Bucket.Status.IamRoleArn, s3Bucket.Spec.Access)
+		s3Bucket.Status.SetCondition(s3operatorv1.ConditionPolicyApplied, s3Bucket.Generation, err)
+		changedFields = appendChangedField(changedFields, "bucketPolicy", isChanged)
+		if isChanged {
+			a.Recorder.Eventf(s3Bucket, corev1.EventTypeNormal, s3operatorv1.EventPolicyApplied,
+				"bucket policy was applied for iam role %s", s3Bucket.Status.IamRoleArn)
+		}
+	}
+	if s3Bucket.Status.ObservedGeneration != s3Bucket.Generation {
+		// the spec was changed, the corrected fields are the result of the change and not a drift
+		log.Info("finish to HandleBucketUpdate", "changed_fields", changedFields)
+		return nil, err
+	}
+	now := metav1.Now()
+	for _, field := range changedFields {
+		s3Bucket.Status.RecordDrift(field, now)
+	}
+	log.Info("finish to HandleBucketUpdate", "drifted_fields", changedFields)
+	return changedFields, err
+}
+
+func appendChangedField(changedFields []string, field string, isChanged bool) []string {
+	if isChanged {
+		return append(changedFields, field)
+	}
+	return changedFields
+}
+
+// IsBucketExists is true when the bucket exists in the account of the operator. a bucket of another account
+// can not be read, it fails with a conflict like a bucket name that is already taken
+func (a *AwsClient) IsBucketExists(ctx context.Context, name string) (bool, error) {
+	_, err := a.s3Client.GetBucketLocationWithContext(ctx, &s3.GetBucketLocationInput{Bucket: aws.String(name)})
 	if err != nil {
 		if awsErr, isAwsErr := err.(awserr.Error); isAwsErr && awsErr.Code() == s3.ErrCodeNoSuchBucket {
 			return false, nil
+		} else if isAwsErr && awsErr.Code() == errCodeAccessDenied {
+			return false, errorkind.Errorf(errorkind.Conflict, "bucket %s already exists and is owned by another account: %w", name, err)
 		}
 		return false, err
 	}
 	return true, nil
 }
 
-func (a *AwsClient) updateBucketTags(bucketName string, tagsToUpdate map[string]string) (bool, error) {
-	a.Log.V(1).Info("UpdateBucketTags function")
+func (a *AwsClient) updateBucketTags(ctx context.Context, bucketName string, tagsToUpdate map[string]string) (bool, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	log.V(1).Info("UpdateBucketTags function")
 	if tagsToUpdate == nil {
 		tagsToUpdate = map[string]string{}
 	}
-	tagsFromAws, err := a.s3Client.GetBucketTagging(&s3.GetBucketTaggingInput{Bucket: aws.String(bucketName)})
+	tagsFromAws, err := a.s3Client.GetBucketTaggingWithContext(ctx, &s3.GetBucketTaggingInput{Bucket: aws.String(bucketName)})
 	if err != nil {
-		a.Log.Error(err, "error from GetBucketTagging")
+		log.Error(err, "error from GetBucketTagging")
 		return false, err
 	}
-	isDiffTags, diffTags := a.findIfDiffTags(tagsToUpdate, tagsFromAws.TagSet)
+	isDiffTags, diffTags := a.findIfDiffTags(ctx, tagsToUpdate, tagsFromAws.TagSet)
 	if isDiffTags {
-		_, err := a.s3Client.PutBucketTagging(&s3.PutBucketTaggingInput{Bucket: &bucketName, Tagging: &s3.Tagging{TagSet: diffTags}})
+		_, err := a.s3Client.PutBucketTaggingWithContext(ctx, &s3.PutBucketTaggingInput{Bucket: &bucketName, Tagging: &s3.Tagging{TagSet: diffTags}})
 		if err != nil {
-			a.Log.Error(err, "error from PutBucketTagging")
+			log.Error(err, "error from PutBucketTagging")
+			return false, err
 		} else {
-			a.Log.Info("finish to update tags")
+			log.Info("finish to update tags")
 
 		}
 	} else {
-		a.Log.Info("no tags to update")
+		log.Info("no tags to update")
 	}
-	return true, nil
+	return isDiffTags, nil
 }
-func (a *AwsClient) findIfDiffTags(tagsToUpdate map[string]string, tagsFromAws []*s3.Tag) (bool, []*s3.Tag) {
-	a.Log.V(1).Info("FindDiffTags function")
+func (a *AwsClient) findIfDiffTags(ctx context.Context, tagsToUpdate map[string]string, tagsFromAws []*s3.Tag) (bool, []*s3.Tag) {
+	log := logr.FromContextOrDiscard(ctx)
+	log.V(1).Info("FindDiffTags function")
 	isDiffTags := false
 	newTags := []*s3.Tag{}
 	mapAwsTags := map[string]string{}
@@ -137,14 +374,14 @@ func (a *AwsClient) findIfDiffTags(tagsToUpdate map[string]string, tagsFromAws [
 		mapAwsTags[*tag.Key] = *tag.Value
 		if len(*tagToCheck.Key) < len(config.TagPrefix()) || (*tagToCheck.Key)[:len(config.TagPrefix())] != config.TagPrefix() {
 			newTags = append(newTags, &tagToCheck) //add all tags that dont have the operator prefix
-			a.Log.Info("add tag from aws", "tag", tagToCheck)
+			log.Info("add tag from aws", "tag", tagToCheck)
 
 		} else { //all the tags from aws that have the Tag prefix
-			tagKeyWithoutPrefix := (*tagToCheck.Key)[:len(config.TagPrefix())]
+			tagKeyWithoutPrefix := (*tagToCheck.Key)[len(config.TagPrefix()):]
 			val, ok := tagsToUpdate[tagKeyWithoutPrefix]
 			if !ok || val != *tagToCheck.Value {
 				isDiffTags = true
-				a.Log.Info("found tags to update", "tagsToUpdate", tagToCheck)
+				log.Info("found tags to update", "tagsToUpdate", tagToCheck)
 			}
 		}
 	}
@@ -152,22 +389,27 @@ func (a *AwsClient) findIfDiffTags(tagsToUpdate map[string]string, tagsFromAws [
 		Tagkey := config.TagPrefix() + key
 		Tagval := val
 		tag := s3.Tag{Key: &Tagkey, Value: &Tagval}
-		a.Log.V(1).Info("add tag from spec", "tag", tag)
+		log.V(1).Info("add tag from spec", "tag", tag)
 		newTags = append(newTags, &tag)
 		val, ok := mapAwsTags[Tagkey]
 		if !ok || val != Tagval {
 			isDiffTags = true
-			a.Log.Info("found tags to update", "tagsToUpdate", tag)
+			log.Info("found tags to update", "tagsToUpdate", tag)
 		}
 
 	}
-	a.Log.V(1).Info("returend from find diff Tags", "isDiffTags", isDiffTags, "newTags", newTags)
+	log.V(1).Info("returend from find diff Tags", "isDiffTags", isDiffTags, "newTags", newTags)
 	return isDiffTags, newTags
 }
-func (a *AwsClient) isBucketManagedByOperator(bucketName string) (bool, error) {
-	tagsFromAws, err := a.s3Client.GetBucketTagging(&s3.GetBucketTaggingInput{Bucket: aws.String(bucketName)})
+func (a *AwsClient) isBucketManagedByOperator(ctx context.Context, bucketName string) (bool, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	tagsFromAws, err := a.s3Client.GetBucketTaggingWithContext(ctx, &s3.GetBucketTaggingInput{Bucket: aws.String(bucketName)})
 	if err != nil {
-		a.Log.Error(err, "error from GetBucketTagging in checkIfOwnerBucketByTag")
+		if awsErr, isAwsErr := err.(awserr.Error); isAwsErr && awsErr.Code() == "NoSuchTagSet" {
+			log.Info("bucket has no tags, bucket is not manage by the operator")
+			return false, nil
+		}
+		log.Error(err, "error from GetBucketTagging in checkIfOwnerBucketByTag")
 		return false, err
 	}
 	defaultTag := config.DefaultTag()
@@ -176,39 +418,68 @@ func (a *AwsClient) isBucketManagedByOperator(bucketName string) (bool, error) {
 			return true, nil
 		}
 	}
-	a.Log.Info("bucket is not manage by the operator")
+	log.Info("bucket is not manage by the operator")
 	return false, nil
 
 }
 
-func (a *AwsClient) createBucket(bucketInput s3.CreateBucketInput) (*s3.CreateBucketOutput, error) {
-	a.Log.Info("Starting to create S3 bucket on AWS", "region", *bucketInput.CreateBucketConfiguration.LocationConstraint)
-	res, err := a.s3Client.CreateBucket(&bucketInput)
+func (a *AwsClient) removeManagedTag(ctx context.Context, bucketName string) error {
+	log := logr.FromContextOrDiscard(ctx)
+	tagsFromAws, err := a.s3Client.GetBucketTaggingWithContext(ctx, &s3.GetBucketTaggingInput{Bucket: aws.String(bucketName)})
+	if err != nil {
+		log.Error(err, "error from GetBucketTagging in removeManagedTag")
+		return err
+	}
+	defaultTag := config.DefaultTag()
+	tags := []*s3.Tag{}
+	for _, tag := range tagsFromAws.TagSet {
+		if defaultTag.GoString() != tag.GoString() {
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) == 0 {
+		_, err = a.s3Client.DeleteBucketTaggingWithContext(ctx, &s3.DeleteBucketTaggingInput{Bucket: aws.String(bucketName)})
+	} else {
+		_, err = a.s3Client.PutBucketTaggingWithContext(ctx, &s3.PutBucketTaggingInput{Bucket: aws.String(bucketName), Tagging: &s3.Tagging{TagSet: tags}})
+	}
+	if err != nil {
+		log.Error(err, "error to remove managed tag from bucket")
+		return err
+	}
+	log.Info("removed managed tag from bucket", "bucket_tags", tags)
+	return nil
+}
+
+func (a *AwsClient) createBucket(ctx context.Context, bucketInput s3.CreateBucketInput) (*s3.CreateBucketOutput, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	log.Info("Starting to create S3 bucket on AWS", "region", *bucketInput.CreateBucketConfiguration.LocationConstraint)
+	res, err := a.s3Client.CreateBucketWithContext(ctx, &bucketInput)
 	if err != nil { //  cast err to awserr.Error to get the Code and
 		if aerr, ok := err.(awserr.Error); ok {
 			switch aerr.Code() {
 			case s3.ErrCodeBucketAlreadyExists:
-				a.Log.Error(aerr, s3.ErrCodeBucketAlreadyExists)
+				log.Error(aerr, s3.ErrCodeBucketAlreadyExists)
 				return nil, aerr
 			case s3.ErrCodeBucketAlreadyOwnedByYou:
-				a.Log.Error(aerr, s3.ErrCodeBucketAlreadyOwnedByYou)
+				log.Error(aerr, s3.ErrCodeBucketAlreadyOwnedByYou)
 				return nil, aerr
 			default:
-				a.Log.Error(aerr, aerr.Error())
+				log.Error(aerr, aerr.Error())
 				return nil, aerr
 			}
 		} else {
 			// Message from an error.
-			a.Log.Error(err, "error in creatBucket function", "region", *bucketInput.CreateBucketConfiguration.LocationConstraint)
+			log.Error(err, "error in creatBucket function", "region", *bucketInput.CreateBucketConfiguration.LocationConstraint)
 			return nil, err
 		}
 	}
-	a.Log.Info("S3 bucket creation finished successfully", "region", *bucketInput.CreateBucketConfiguration.LocationConstraint)
+	log.Info("S3 bucket creation finished successfully", "region", *bucketInput.CreateBucketConfiguration.LocationConstraint)
 	return res, nil
 
 }
 
-func (a *AwsClient) putBucketTagging(bucketName string, bucketTags *map[string]string) (bool, error) {
+func (a *AwsClient) putBucketTagging(ctx context.Context, bucketName string, bucketTags *map[string]string) (bool, error) {
+	log := logr.FromContextOrDiscard(ctx)
 	tags := make([]*s3.Tag, 0)
 	for key, val := range *bucketTags {
 		Tagkey := config.TagPrefix() + key
@@ -225,13 +496,13 @@ func (a *AwsClient) putBucketTagging(bucketName string, bucketTags *map[string]s
 		Bucket:  aws.String(bucketName),
 		Tagging: &s3.Tagging{TagSet: tags},
 	}
-	a.Log.Info("Adding Tags to s3 bucket", "bucket_tags", *input.Tagging)
-	_, err := a.s3Client.PutBucketTagging(input)
+	log.Info("Adding Tags to s3 bucket", "bucket_tags", *input.Tagging)
+	_, err := a.s3Client.PutBucketTaggingWithContext(ctx, input)
 	if err != nil {
-		a.Log.Error(err, "error PutBucketTagging")
+		log.Error(err, "error PutBucketTagging")
 		return false, err
 	}
-	a.Log.Info("S3 bucket tagging finished successfully", "bucket_tags", *input.Tagging)
+	log.Info("S3 bucket tagging finished successfully", "bucket_tags", *input.Tagging)
 	return true, nil
 }
 
@@ -243,54 +514,81 @@ func (a *AwsClient) createBucketInput(bucketName string, bucketRegion string) *s
 	return s3Input
 }
 
-func (a *AwsClient) deleteBucket(bucketName string) (*s3.DeleteBucketOutput, error) {
-	a.Log.Info("DeleteBucket function")
-	res, err := a.s3Client.DeleteBucket(&s3.DeleteBucketInput{Bucket: aws.String(bucketName)})
+func (a *AwsClient) deleteBucket(ctx context.Context, bucketName string) (*s3.DeleteBucketOutput, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	log.Info("DeleteBucket function")
+	res, err := a.s3Client.DeleteBucketWithContext(ctx, &s3.DeleteBucketInput{Bucket: aws.String(bucketName)})
 	return res, err
 }
 
-// cleanupsBucketContent function - delete all the object that inside the bucket (required for deleting bucket)
-func (a *AwsClient) cleanupsBucketContent(bucketName string) error {
-	a.Log.V(1).Info("CleanupsBucket function")
+// cleanupsBucketContent function - delete all the object versions and delete markers that inside the bucket (required for deleting bucket)
+func (a *AwsClient) cleanupsBucketContent(ctx context.Context, bucketName string) error {
+	log := logr.FromContextOrDiscard(ctx)
+	log.V(1).Info("CleanupsBucket function")
+	if plan := dryrun.FromContext(ctx); plan != nil {
+		// the content is not listed in dry-run, a bucket with many objects would make a page of calls for each listing
+		plan.Add(s3.ServiceName, "DeleteObjects", fmt.Sprintf("every object version of bucket %s", bucketName))
+		return nil
+	}
 
-	iter := s3manager.NewDeleteListIterator(a.s3Client, &s3.ListObjectsInput{
+	var deleteErr error
+	input := &s3.ListObjectVersionsInput{Bucket: aws.String(bucketName), MaxKeys: config.ResourcesPerPage()}
+	err := a.s3Client.ListObjectVersionsPagesWithContext(ctx, input, func(page *s3.ListObjectVersionsOutput, lastPage bool) bool {
+		objects := make([]*s3.ObjectIdentifier, 0, len(page.Versions)+len(page.DeleteMarkers))
+		for _, version := range page.Versions {
+			objects = append(objects, &s3.ObjectIdentifier{Key: version.Key, VersionId: version.VersionId})
+		}
+		for _, marker := range page.DeleteMarkers {
+			objects = append(objects, &s3.ObjectIdentifier{Key: marker.Key, VersionId: marker.VersionId})
+		}
+		if len(objects) == 0 {
+			return true
+		}
+		deleteErr = a.deleteObjects(ctx, bucketName, objects)
+		return deleteErr == nil
+	})
+	if err == nil {
+		err = deleteErr
+	}
+	if err != nil {
+		log.Error(err, "Unable to delete objects from bucket")
+		return err
+	}
+	log.Info("succeded to cleanup bucket")
+	return nil
+}
+
+func (a *AwsClient) deleteObjects(ctx context.Context, bucketName string, objects []*s3.ObjectIdentifier) error {
+	log := logr.FromContextOrDiscard(ctx)
+	log.V(1).Info("delete objects from bucket", "objects_count", len(objects))
+	res, err := a.s3Client.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
 		Bucket: aws.String(bucketName),
+		Delete: &s3.Delete{Objects: objects, Quiet: aws.Bool(true)},
 	})
-	if err := s3manager.NewBatchDeleteWithClient(a.s3Client).Delete(aws.BackgroundContext(), iter); err != nil {
-		a.Log.Error(err, "Unable to delete objects from bucket")
+	if err != nil {
 		return err
 	}
-	a.Log.Info("succeded to cleanup bucket")
+	if len(res.Errors) > 0 {
+		deleteErr := res.Errors[0]
+		return fmt.Errorf("didnt succeded to delete %d objects, first error on key %s: %s",
+			len(res.Errors), aws.StringValue(deleteErr.Key), aws.StringValue(deleteErr.Message))
+	}
 	return nil
 }
 
-func (a *AwsClient) putBucketPolicy(bucketName string, iamRole string) (*s3.PutBucketPolicyOutput, error) {
-	a.Log.Info("adding bucket policy for s3 bucket", "iamRole:", iamRole)
-
-	// Create a policy using map interface. Filling in the bucket as the
-	// resource.
-	AllPremisionToRole := map[string]interface{}{
-		"Version": "2012-10-17",
-		"Statement": []map[string]interface{}{
-			{
-				"Sid":    "AllPremisionToRole" + bucketName,
-				"Effect": "Allow",
-				"Principal": []string{
-					"AWS: " + iamRole,
-				},
-				"Action": []string{
-					"s3:*",
-				},
-				"Resource": []string{
-					"arn:aws:s3:::" + bucketName,
-					"arn:aws:s3:::" + bucketName + "/*",
-				},
-			},
-		},
-	}
-	bucketPolicy, err := json.Marshal(AllPremisionToRole)
+func (a *AwsClient) putBucketPolicy(ctx context.Context, bucketName string, roleArn string, access *s3operatorv1.BucketAccess) (*s3.PutBucketPolicyOutput, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	log.Info("adding bucket policy for s3 bucket", "iamRole:", roleArn)
+	if roleArn == "" {
+		return nil, errors.New("iam role of the bucket is not ready")
+	}
+	policyOfRole, err := buildBucketPolicy(a.GetBucketArn(bucketName), roleArn, access)
 	if err != nil {
-		a.Log.Error(err, "error in PutBucketPolicy in Marshal", "iamRole:", iamRole)
+		return nil, err
+	}
+	bucketPolicy, err := json.Marshal(policyOfRole)
+	if err != nil {
+		log.Error(err, "error in PutBucketPolicy in Marshal", "iamRole:", roleArn)
 		return nil, err
 
 	}
@@ -299,39 +597,58 @@ func (a *AwsClient) putBucketPolicy(bucketName string, iamRole string) (*s3.PutB
 		Bucket: &bucketName,
 		Policy: aws.String(string(bucketPolicy)),
 	}
-	res, err := a.s3Client.PutBucketPolicy(input)
+	res, err := a.s3Client.PutBucketPolicyWithContext(ctx, input)
 	if err != nil {
-		a.Log.Error(err, "error in put bucket policy", bucketName, "policy:", *input.Policy)
+		log.Error(err, "error in put bucket policy", bucketName, "policy:", *input.Policy)
 	} else {
-		a.Log.Info("Attach bucket policy to s3 bucket finished successfully", "policy:", *input.Policy)
+		log.Info("Attach bucket policy to s3 bucket finished successfully", "policy:", *input.Policy)
 	}
 	return res, err
 }
 
-func (a *AwsClient) putBucketEncrypt(bucketName string) (bool, error) {
-	a.Log.Info("PutBucketEncrypt function")
-	encryptRules := []*s3.ServerSideEncryptionRule{{
-		BucketKeyEnabled:                   aws.Bool(true),
-		ApplyServerSideEncryptionByDefault: &s3.ServerSideEncryptionByDefault{SSEAlgorithm: aws.String("AES256")}},
-	}
-	sSEncryptConfiguration := s3.ServerSideEncryptionConfiguration{
-		Rules: encryptRules,
-	}
-
-	input := &s3.PutBucketEncryptionInput{
-		Bucket:                            &bucketName,
-		ServerSideEncryptionConfiguration: &sSEncryptConfiguration,
+// updateBucketPolicy compares the bucket policy in aws to the access of the spec and corrects it,
+// the returned bool is true when the policy was changed
+func (a *AwsClient) updateBucketPolicy(ctx context.Context, bucketName string, roleArn string, access *s3operatorv1.BucketAccess) (bool, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	log.V(1).Info("UpdateBucketPolicy function")
+	policyOfRole, err := buildBucketPolicy(a.GetBucketArn(bucketName), roleArn, access)
+	if err != nil {
+		return false, err
 	}
-	a.Log.Info("PutBucketEncryption input", "ServerSideEncryptionConfiguration:", *input.ServerSideEncryptionConfiguration)
-	_, err := a.s3Client.PutBucketEncryption(input)
+	bucketPolicy, err := json.Marshal(policyOfRole)
 	if err != nil {
-		a.Log.Error(err, "not succsede to PutBucketEncrypt")
 		return false, err
 	}
-	a.Log.Info("succeded to encrypt bucket")
-	return true, nil
+	res, err := a.s3Client.GetBucketPolicyWithContext(ctx, &s3.GetBucketPolicyInput{Bucket: aws.String(bucketName)})
+	if err != nil {
+		if awsErr, isAwsErr := err.(awserr.Error); !isAwsErr || awsErr.Code() != errCodeNoSuchBucketPolicy {
+			log.Error(err, "error from GetBucketPolicy")
+			return false, err
+		}
+	} else if isPolicyEqual(aws.StringValue(res.Policy), string(bucketPolicy)) {
+		log.V(1).Info("no bucket policy to update")
+		return false, nil
+	}
+	_, err = a.putBucketPolicy(ctx, bucketName, roleArn, access)
+	return true, err
+}
 
+// getBucketEndpoint returns the url of the bucket, according to the addressing style of the s3 client
+func (a *AwsClient) getBucketEndpoint(ctx context.Context, bucketName string) string {
+	log := logr.FromContextOrDiscard(ctx)
+	endpoint, err := url.Parse(a.s3Client.Endpoint)
+	if err != nil {
+		log.Error(err, "error to parse s3 endpoint", "endpoint", a.s3Client.Endpoint)
+		return ""
+	}
+	if config.AwsS3ForcePathStyle() {
+		endpoint.Path = "/" + bucketName
+	} else {
+		endpoint.Host = bucketName + "." + endpoint.Host
+	}
+	return endpoint.String()
 }
+
 func SetS3Client(Log *logr.Logger, ses *session.Session) *s3.S3 {
 	Log.Info("create s3Client wit session", "session", *ses)
 	s3Client := s3.New(ses)
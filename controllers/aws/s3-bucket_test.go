@@ -0,0 +1,209 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	s3operatorv1 "github.com/PayU/K8s-S3-Operator/api/v1"
+	"github.com/PayU/K8s-S3-Operator/controllers/config"
+	"github.com/PayU/K8s-S3-Operator/controllers/dryrun"
+	"github.com/PayU/K8s-S3-Operator/controllers/errorkind"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/go-logr/logr"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestFindIfDiffTagsIgnoresTagsInSync(t *testing.T) {
+	g := NewWithT(t)
+	ctx := logr.NewContext(context.Background(), logr.Discard())
+	awsClient := &AwsClient{}
+	tagsFromAws := []*s3.Tag{
+		config.DefaultTag(),
+		{Key: aws.String(config.TagPrefix() + "team"), Value: aws.String("payments")},
+		{Key: aws.String("owner"), Value: aws.String("someone-else")},
+	}
+
+	isDiffTags, _ := awsClient.findIfDiffTags(ctx, map[string]string{"team": "payments"}, tagsFromAws)
+	g.Expect(isDiffTags).To(BeFalse())
+
+	isDiffTags, newTags := awsClient.findIfDiffTags(ctx, map[string]string{"team": "risk"}, tagsFromAws)
+	g.Expect(isDiffTags).To(BeTrue())
+	g.Expect(newTags).To(ContainElement(&s3.Tag{Key: aws.String(config.TagPrefix() + "team"), Value: aws.String("risk")}))
+	g.Expect(newTags).To(ContainElement(&s3.Tag{Key: aws.String("owner"), Value: aws.String("someone-else")}))
+
+	isDiffTags, _ = awsClient.findIfDiffTags(ctx, map[string]string{}, tagsFromAws)
+	g.Expect(isDiffTags).To(BeTrue())
+}
+
+func TestIsBucketExistsOfAnotherAccountIsAConflict(t *testing.T) {
+	g := NewWithT(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, "<Error><Code>AccessDenied</Code><Message>access denied</Message></Error>")
+	}))
+	defer server.Close()
+	ses := session.Must(session.NewSession(&aws.Config{
+		Region:           aws.String("eu-central-1"),
+		Endpoint:         aws.String(server.URL),
+		Credentials:      credentials.AnonymousCredentials,
+		S3ForcePathStyle: aws.Bool(true),
+	}))
+	awsClient := &AwsClient{s3Client: s3.New(ses)}
+
+	isBucketExists, err := awsClient.IsBucketExists(context.Background(), "bucket")
+	g.Expect(isBucketExists).To(BeFalse())
+	kind, isKnown := errorkind.Of(err)
+	g.Expect(isKnown).To(BeTrue())
+	g.Expect(kind).To(Equal(errorkind.Conflict))
+}
+
+// newManagedBucketServer serves a bucket and a role that are managed by the operator, the bucket has one object version
+func newManagedBucketServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		switch {
+		case r.URL.Path == "/" && r.FormValue("Action") == "GetRole":
+			fmt.Fprint(w, "<GetRoleResponse><GetRoleResult><Role><RoleName>bucket-role</RoleName>"+
+				"<Tags><member><Key>createdBy</Key><Value>s3Operator</Value></member></Tags></Role></GetRoleResult></GetRoleResponse>")
+		case r.URL.Path == "/":
+			fmt.Fprintf(w, "<%sResponse></%sResponse>", r.FormValue("Action"), r.FormValue("Action"))
+		case query.Has("location"):
+			fmt.Fprint(w, "<LocationConstraint>eu-central-1</LocationConstraint>")
+		case query.Has("tagging") && r.Method == http.MethodGet:
+			fmt.Fprint(w, "<Tagging><TagSet><Tag><Key>createdBy</Key><Value>s3Operator</Value></Tag>"+
+				"<Tag><Key>owner</Key><Value>payments</Value></Tag></TagSet></Tagging>")
+		case query.Has("versions"):
+			fmt.Fprint(w, "<ListVersionsResult><Version><Key>report.csv</Key><VersionId>1</VersionId></Version></ListVersionsResult>")
+		case query.Has("delete"):
+			fmt.Fprint(w, "<DeleteResult></DeleteResult>")
+		case r.Method == http.MethodDelete:
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+}
+
+// newRecordingAwsClient returns a client of the test server that records the name of every aws operation it sends
+func newRecordingAwsClient(server *httptest.Server, operations *[]string) *AwsClient {
+	ses := newTestSession(server)
+	ses.Handlers.Send.PushFront(func(r *request.Request) {
+		*operations = append(*operations, r.Operation.Name)
+	})
+	logger := logr.Discard()
+	return NewAwsClientFromSession(&logger, ses, nil, record.NewFakeRecorder(10), Identity{Partition: "aws", AccountId: "111122223333"})
+}
+
+func TestHandleBucketDeletionPolicies(t *testing.T) {
+	g := NewWithT(t)
+	ctx := logr.NewContext(context.Background(), logr.Discard())
+	server := newManagedBucketServer()
+	defer server.Close()
+	operations := []string{}
+	awsClient := newRecordingAwsClient(server, &operations)
+	s3Bucket := &s3operatorv1.S3Bucket{ObjectMeta: metav1.ObjectMeta{Name: "bucket", Namespace: "team-a"}}
+	s3Bucket.Status.IamRoleName = "bucket-role"
+
+	s3Bucket.Spec.DeletionPolicy = s3operatorv1.DeletionPolicyOrphan
+	isDeleted, err := awsClient.HandleBucketDeletion(ctx, s3Bucket)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(isDeleted).To(BeFalse())
+	g.Expect(operations).To(BeEmpty())
+
+	// retain keeps the bucket and the role, only the managed tag is removed from them
+	s3Bucket.Spec.DeletionPolicy = s3operatorv1.DeletionPolicyRetain
+	isDeleted, err = awsClient.HandleBucketDeletion(ctx, s3Bucket)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(isDeleted).To(BeFalse())
+	g.Expect(operations).To(Equal([]string{"GetBucketLocation", "GetBucketTagging", "GetBucketTagging", "PutBucketTagging", "GetRole", "UntagRole"}))
+
+	// without a policy in the spec the default of the operator is applied, which is Delete
+	operations = []string{}
+	s3Bucket.Spec.DeletionPolicy = ""
+	g.Expect(config.DefaultDeletionPolicy()).To(Equal(string(s3operatorv1.DeletionPolicyDelete)))
+	isDeleted, err = awsClient.HandleBucketDeletion(ctx, s3Bucket)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(isDeleted).To(BeTrue())
+	g.Expect(operations).To(Equal([]string{"GetBucketLocation", "GetBucketTagging", "ListObjectVersions", "DeleteObjects", "DeleteBucket",
+		"GetRole", "ListRolePolicies", "ListAttachedRolePolicies", "ListInstanceProfilesForRole", "DeleteRole"}))
+}
+
+func TestCleanupBucketContentDeletesEveryVersion(t *testing.T) {
+	g := NewWithT(t)
+	ctx := logr.NewContext(context.Background(), logr.Discard())
+	deleteRequests := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		switch {
+		case query.Has("versions") && query.Get("key-marker") == "":
+			fmt.Fprint(w, "<ListVersionsResult><IsTruncated>true</IsTruncated><NextKeyMarker>b.csv</NextKeyMarker><NextVersionIdMarker>2</NextVersionIdMarker>"+
+				"<Version><Key>a.csv</Key><VersionId>1</VersionId></Version>"+
+				"<DeleteMarker><Key>b.csv</Key><VersionId>2</VersionId></DeleteMarker></ListVersionsResult>")
+		case query.Has("versions"):
+			g.Expect(query.Get("key-marker")).To(Equal("b.csv"))
+			g.Expect(query.Get("version-id-marker")).To(Equal("2"))
+			fmt.Fprint(w, "<ListVersionsResult><IsTruncated>false</IsTruncated>"+
+				"<Version><Key>c.csv</Key><VersionId>3</VersionId></Version></ListVersionsResult>")
+		case query.Has("delete"):
+			body, err := io.ReadAll(r.Body)
+			g.Expect(err).NotTo(HaveOccurred())
+			deleteRequests = append(deleteRequests, string(body))
+			fmt.Fprint(w, "<DeleteResult></DeleteResult>")
+		}
+	}))
+	defer server.Close()
+	operations := []string{}
+	awsClient := newRecordingAwsClient(server, &operations)
+
+	g.Expect(awsClient.cleanupsBucketContent(ctx, "bucket")).To(Succeed())
+	g.Expect(operations).To(Equal([]string{"ListObjectVersions", "DeleteObjects", "ListObjectVersions", "DeleteObjects"}))
+	g.Expect(deleteRequests).To(HaveLen(2))
+	g.Expect(deleteRequests[0]).To(MatchRegexp("<Object>(<Key>a.csv</Key><VersionId>1</VersionId>|<VersionId>1</VersionId><Key>a.csv</Key>)</Object>"))
+	g.Expect(deleteRequests[0]).To(MatchRegexp("<Object>(<Key>b.csv</Key><VersionId>2</VersionId>|<VersionId>2</VersionId><Key>b.csv</Key>)</Object>"))
+	g.Expect(deleteRequests[1]).To(MatchRegexp("<Object>(<Key>c.csv</Key><VersionId>3</VersionId>|<VersionId>3</VersionId><Key>c.csv</Key>)</Object>"))
+}
+
+func TestCleanupBucketContentFailsOnObjectErrors(t *testing.T) {
+	g := NewWithT(t)
+	ctx := logr.NewContext(context.Background(), logr.Discard())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Has("versions") {
+			fmt.Fprint(w, "<ListVersionsResult><IsTruncated>true</IsTruncated><NextKeyMarker>a.csv</NextKeyMarker>"+
+				"<Version><Key>a.csv</Key><VersionId>1</VersionId></Version></ListVersionsResult>")
+			return
+		}
+		fmt.Fprint(w, "<DeleteResult><Error><Key>a.csv</Key><Code>AccessDenied</Code><Message>access denied</Message></Error></DeleteResult>")
+	}))
+	defer server.Close()
+	operations := []string{}
+	awsClient := newRecordingAwsClient(server, &operations)
+
+	// the listing stops at the first page that was not deleted
+	g.Expect(awsClient.cleanupsBucketContent(ctx, "bucket")).To(MatchError(ContainSubstring("first error on key a.csv")))
+	g.Expect(operations).To(Equal([]string{"ListObjectVersions", "DeleteObjects"}))
+}
+
+func TestDryRunCleanupBucketContentIsNotListed(t *testing.T) {
+	g := NewWithT(t)
+	plan := &dryrun.Plan{}
+	ctx := dryrun.NewContext(logr.NewContext(context.Background(), logr.Discard()), plan)
+	server := newManagedBucketServer()
+	defer server.Close()
+	operations := []string{}
+	awsClient := newRecordingAwsClient(server, &operations)
+
+	g.Expect(awsClient.cleanupsBucketContent(ctx, "bucket")).To(Succeed())
+	g.Expect(operations).To(BeEmpty())
+	g.Expect(plan.Changes()).To(Equal([]s3operatorv1.PlannedChange{{Service: "s3", Operation: "DeleteObjects",
+		Details: "every object version of bucket bucket"}}))
+}
@@ -0,0 +1,123 @@
+package aws
+
+import (
+	"context"
+	"reflect"
+
+	s3operatorv1 "github.com/PayU/K8s-S3-Operator/api/v1"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/go-logr/logr"
+)
+
+const errCodeNoSuchCORSConfiguration = "NoSuchCORSConfiguration"
+
+func (a *AwsClient) putBucketCors(ctx context.Context, bucketName string, rules []s3operatorv1.CORSRule) error {
+	log := logr.FromContextOrDiscard(ctx)
+	log.Info("PutBucketCors function", "rules_count", len(rules))
+	_, err := a.s3Client.PutBucketCorsWithContext(ctx, &s3.PutBucketCorsInput{
+		Bucket:            aws.String(bucketName),
+		CORSConfiguration: &s3.CORSConfiguration{CORSRules: corsRulesToAws(rules)},
+	})
+	if err != nil {
+		log.Error(err, "error from PutBucketCors")
+		return err
+	}
+	log.Info("succeded to put bucket cors configuration")
+	return nil
+}
+
+// updateBucketCors compares the cors rules in aws to the spec and corrects them, the cors
+// configuration is deleted when the spec has no rules. the returned bool is true when it was changed
+func (a *AwsClient) updateBucketCors(ctx context.Context, bucketName string, rules []s3operatorv1.CORSRule) (bool, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	log.V(1).Info("UpdateBucketCors function")
+	currentRules := []s3operatorv1.CORSRule{}
+	res, err := a.s3Client.GetBucketCorsWithContext(ctx, &s3.GetBucketCorsInput{Bucket: aws.String(bucketName)})
+	if err != nil {
+		if awsErr, isAwsErr := err.(awserr.Error); !isAwsErr || awsErr.Code() != errCodeNoSuchCORSConfiguration {
+			log.Error(err, "error from GetBucketCors")
+			return false, err
+		}
+	} else {
+		currentRules = corsRulesFromAws(res.CORSRules)
+	}
+	if isCorsRulesEqual(rules, currentRules) {
+		log.V(1).Info("no cors rules to update")
+		return false, nil
+	}
+	log.Info("found cors rules to update", "current_rules", currentRules, "rules", rules)
+	if len(rules) == 0 {
+		_, err = a.s3Client.DeleteBucketCorsWithContext(ctx, &s3.DeleteBucketCorsInput{Bucket: aws.String(bucketName)})
+		if err != nil {
+			log.Error(err, "error from DeleteBucketCors")
+		}
+		return true, err
+	}
+	return true, a.putBucketCors(ctx, bucketName, rules)
+}
+
+func corsRulesToAws(rules []s3operatorv1.CORSRule) []*s3.CORSRule {
+	awsRules := make([]*s3.CORSRule, 0, len(rules))
+	for _, rule := range rules {
+		awsRule := &s3.CORSRule{
+			AllowedOrigins: aws.StringSlice(rule.AllowedOrigins),
+			MaxAgeSeconds:  rule.MaxAgeSeconds,
+		}
+		if rule.ID != "" {
+			awsRule.ID = aws.String(rule.ID)
+		}
+		for _, method := range rule.AllowedMethods {
+			awsRule.AllowedMethods = append(awsRule.AllowedMethods, aws.String(string(method)))
+		}
+		if len(rule.AllowedHeaders) > 0 {
+			awsRule.AllowedHeaders = aws.StringSlice(rule.AllowedHeaders)
+		}
+		if len(rule.ExposedHeaders) > 0 {
+			awsRule.ExposeHeaders = aws.StringSlice(rule.ExposedHeaders)
+		}
+		awsRules = append(awsRules, awsRule)
+	}
+	return awsRules
+}
+
+func corsRulesFromAws(awsRules []*s3.CORSRule) []s3operatorv1.CORSRule {
+	rules := make([]s3operatorv1.CORSRule, 0, len(awsRules))
+	for _, awsRule := range awsRules {
+		rule := s3operatorv1.CORSRule{
+			ID:             aws.StringValue(awsRule.ID),
+			AllowedOrigins: aws.StringValueSlice(awsRule.AllowedOrigins),
+			AllowedHeaders: aws.StringValueSlice(awsRule.AllowedHeaders),
+			ExposedHeaders: aws.StringValueSlice(awsRule.ExposeHeaders),
+		}
+		if awsRule.MaxAgeSeconds != nil {
+			rule.MaxAgeSeconds = aws.Int64(*awsRule.MaxAgeSeconds)
+		}
+		for _, method := range awsRule.AllowedMethods {
+			rule.AllowedMethods = append(rule.AllowedMethods, s3operatorv1.CORSMethod(aws.StringValue(method)))
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// isCorsRulesEqual compares the rules in order, since the first matching rule is used by aws
+func isCorsRulesEqual(desired []s3operatorv1.CORSRule, current []s3operatorv1.CORSRule) bool {
+	return reflect.DeepEqual(normalizeCorsRules(desired), normalizeCorsRules(current))
+}
+
+func normalizeCorsRules(rules []s3operatorv1.CORSRule) []s3operatorv1.CORSRule {
+	normalized := make([]s3operatorv1.CORSRule, 0, len(rules))
+	for _, rule := range rules {
+		rule := *rule.DeepCopy()
+		if len(rule.AllowedHeaders) == 0 {
+			rule.AllowedHeaders = nil
+		}
+		if len(rule.ExposedHeaders) == 0 {
+			rule.ExposedHeaders = nil
+		}
+		normalized = append(normalized, rule)
+	}
+	return normalized
+}
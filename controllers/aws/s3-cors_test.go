@@ -0,0 +1,26 @@
+package aws
+
+import (
+	"testing"
+
+	s3operatorv1 "github.com/PayU/K8s-S3-Operator/api/v1"
+	"github.com/aws/aws-sdk-go/aws"
+	. "github.com/onsi/gomega"
+)
+
+func TestCorsRulesRoundTripHasNoDrift(t *testing.T) {
+	g := NewWithT(t)
+	rules := []s3operatorv1.CORSRule{{
+		AllowedOrigins: []string{"https://app.example.com"},
+		AllowedMethods: []s3operatorv1.CORSMethod{"GET", "PUT"},
+		ExposedHeaders: []string{"ETag"},
+		MaxAgeSeconds:  aws.Int64(3000),
+	}}
+
+	g.Expect(isCorsRulesEqual(rules, corsRulesFromAws(corsRulesToAws(rules)))).To(BeTrue())
+
+	changed := corsRulesFromAws(corsRulesToAws(rules))
+	changed[0].AllowedMethods = []s3operatorv1.CORSMethod{"GET"}
+	g.Expect(isCorsRulesEqual(rules, changed)).To(BeFalse())
+	g.Expect(isCorsRulesEqual(nil, []s3operatorv1.CORSRule{})).To(BeTrue())
+}
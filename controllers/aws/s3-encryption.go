@@ -0,0 +1,115 @@
+package aws
+
+import (
+	"context"
+	"reflect"
+	"strings"
+
+	s3operatorv1 "github.com/PayU/K8s-S3-Operator/api/v1"
+	"github.com/PayU/K8s-S3-Operator/controllers/config"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/go-logr/logr"
+)
+
+const serverSideEncryptionAwsKmsDsse = "aws:kms:dsse"
+const errCodeServerSideEncryptionConfigurationNotFound = "ServerSideEncryptionConfigurationNotFoundError"
+
+// encryptionRuleFromSpec builds the default encryption rule of the bucket, AES256 when the algorithm is not set
+func encryptionRuleFromSpec(encryption *s3operatorv1.BucketEncryption) *s3.ServerSideEncryptionRule {
+	algorithm := encryption.Algorithm
+	if algorithm == "" {
+		algorithm = s3.ServerSideEncryptionAes256
+	}
+	bucketKey := algorithm != serverSideEncryptionAwsKmsDsse
+	if encryption.BucketKey != nil {
+		bucketKey = *encryption.BucketKey
+	}
+	rule := &s3.ServerSideEncryptionRule{
+		BucketKeyEnabled:                   aws.Bool(bucketKey),
+		ApplyServerSideEncryptionByDefault: &s3.ServerSideEncryptionByDefault{SSEAlgorithm: aws.String(algorithm)},
+	}
+	if isKmsAlgorithm(algorithm) && encryption.KmsKeyId != "" {
+		rule.ApplyServerSideEncryptionByDefault.KMSMasterKeyID = aws.String(encryption.KmsKeyId)
+	}
+	return rule
+}
+
+func isKmsAlgorithm(algorithm string) bool {
+	return algorithm == s3.ServerSideEncryptionAwsKms || algorithm == serverSideEncryptionAwsKmsDsse
+}
+
+func (a *AwsClient) putBucketEncrypt(ctx context.Context, bucketName string, encryption *s3operatorv1.BucketEncryption) (bool, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	log.Info("PutBucketEncrypt function")
+	input := &s3.PutBucketEncryptionInput{
+		Bucket: &bucketName,
+		ServerSideEncryptionConfiguration: &s3.ServerSideEncryptionConfiguration{
+			Rules: []*s3.ServerSideEncryptionRule{encryptionRuleFromSpec(encryption)},
+		},
+	}
+	log.Info("PutBucketEncryption input", "ServerSideEncryptionConfiguration:", *input.ServerSideEncryptionConfiguration)
+	_, err := a.s3Client.PutBucketEncryptionWithContext(ctx, input)
+	if err != nil {
+		log.Error(err, "not succsede to PutBucketEncrypt")
+		return false, err
+	}
+	log.Info("succeded to encrypt bucket")
+	return true, nil
+
+}
+
+// updateBucketEncryption compares the default encryption in aws to the spec and corrects it,
+// the returned bool is true when the encryption was changed
+func (a *AwsClient) updateBucketEncryption(ctx context.Context, bucketName string, encryption *s3operatorv1.BucketEncryption) (bool, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	log.V(1).Info("UpdateBucketEncryption function")
+	var currentRule *s3.ServerSideEncryptionRule
+	res, err := a.s3Client.GetBucketEncryptionWithContext(ctx, &s3.GetBucketEncryptionInput{Bucket: aws.String(bucketName)})
+	if err != nil {
+		if awsErr, isAwsErr := err.(awserr.Error); !isAwsErr || awsErr.Code() != errCodeServerSideEncryptionConfigurationNotFound {
+			log.Error(err, "error from GetBucketEncryption")
+			return false, err
+		}
+	} else if res.ServerSideEncryptionConfiguration != nil && len(res.ServerSideEncryptionConfiguration.Rules) > 0 {
+		currentRule = res.ServerSideEncryptionConfiguration.Rules[0]
+	}
+	rule := encryptionRuleFromSpec(encryption)
+	if currentRule != nil && aws.BoolValue(currentRule.BucketKeyEnabled) == aws.BoolValue(rule.BucketKeyEnabled) &&
+		reflect.DeepEqual(currentRule.ApplyServerSideEncryptionByDefault, rule.ApplyServerSideEncryptionByDefault) {
+		log.V(1).Info("no encryption to update")
+		return false, nil
+	}
+	log.Info("found encryption to update", "current_rule", currentRule, "rule", rule)
+	return a.putBucketEncrypt(ctx, bucketName, encryption)
+}
+
+// kmsKeyStatement allows the bucket role to use the customer managed key of the bucket,
+// nil is returned when the bucket is not encrypted with a customer managed key
+func kmsKeyStatement(partition string, encryption *s3operatorv1.BucketEncryption) map[string]interface{} {
+	if encryption == nil || !isKmsAlgorithm(encryption.Algorithm) || encryption.KmsKeyId == "" {
+		return nil
+	}
+	statement := map[string]interface{}{
+		"Sid":    "KmsKeyOfBucket",
+		"Effect": "Allow",
+		"Action": []string{
+			"kms:Decrypt",
+			"kms:GenerateDataKey",
+		},
+	}
+	keyId := encryption.KmsKeyId
+	if index := strings.Index(keyId, "alias/"); index != -1 {
+		// an alias cant be used as resource, the key is matched by its alias instead
+		statement["Resource"] = "*"
+		statement["Condition"] = map[string]interface{}{
+			"ForAnyValue:StringEquals": map[string]interface{}{"kms:ResourceAliases": keyId[index:]},
+		}
+	} else if strings.HasPrefix(keyId, "arn:") {
+		statement["Resource"] = keyId
+	} else {
+		statement["Resource"] = buildArn(partition, "kms", config.Region(), "*", "key/"+keyId)
+	}
+	return statement
+}
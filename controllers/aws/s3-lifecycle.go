@@ -0,0 +1,185 @@
+package aws
+
+import (
+	"context"
+	"reflect"
+	"sort"
+
+	s3operatorv1 "github.com/PayU/K8s-S3-Operator/api/v1"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/go-logr/logr"
+)
+
+const errCodeNoSuchLifecycleConfiguration = "NoSuchLifecycleConfiguration"
+
+func (a *AwsClient) putBucketLifecycle(ctx context.Context, bucketName string, rules []s3operatorv1.LifecycleRule) error {
+	log := logr.FromContextOrDiscard(ctx)
+	log.Info("PutBucketLifecycleConfiguration function", "rules_count", len(rules))
+	_, err := a.s3Client.PutBucketLifecycleConfigurationWithContext(ctx, &s3.PutBucketLifecycleConfigurationInput{
+		Bucket:                 aws.String(bucketName),
+		LifecycleConfiguration: &s3.BucketLifecycleConfiguration{Rules: lifecycleRulesToAws(rules)},
+	})
+	if err != nil {
+		log.Error(err, "error from PutBucketLifecycleConfiguration")
+		return err
+	}
+	log.Info("succeded to put bucket lifecycle configuration")
+	return nil
+}
+
+// updateBucketLifecycle compares the lifecycle rules in aws to the spec and corrects them, the lifecycle
+// configuration is deleted when the spec has no rules. the returned bool is true when it was changed
+func (a *AwsClient) updateBucketLifecycle(ctx context.Context, bucketName string, rules []s3operatorv1.LifecycleRule) (bool, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	log.V(1).Info("UpdateBucketLifecycle function")
+	currentRules := []s3operatorv1.LifecycleRule{}
+	res, err := a.s3Client.GetBucketLifecycleConfigurationWithContext(ctx, &s3.GetBucketLifecycleConfigurationInput{Bucket: aws.String(bucketName)})
+	if err != nil {
+		if awsErr, isAwsErr := err.(awserr.Error); !isAwsErr || awsErr.Code() != errCodeNoSuchLifecycleConfiguration {
+			log.Error(err, "error from GetBucketLifecycleConfiguration")
+			return false, err
+		}
+	} else {
+		currentRules = lifecycleRulesFromAws(res.Rules)
+	}
+	if isLifecycleRulesEqual(rules, currentRules) {
+		log.V(1).Info("no lifecycle rules to update")
+		return false, nil
+	}
+	log.Info("found lifecycle rules to update", "current_rules", currentRules, "rules", rules)
+	if len(rules) == 0 {
+		_, err = a.s3Client.DeleteBucketLifecycleWithContext(ctx, &s3.DeleteBucketLifecycleInput{Bucket: aws.String(bucketName)})
+		if err != nil {
+			log.Error(err, "error from DeleteBucketLifecycle")
+		}
+		return true, err
+	}
+	return true, a.putBucketLifecycle(ctx, bucketName, rules)
+}
+
+func lifecycleRulesToAws(rules []s3operatorv1.LifecycleRule) []*s3.LifecycleRule {
+	awsRules := make([]*s3.LifecycleRule, 0, len(rules))
+	for _, rule := range rules {
+		awsRule := &s3.LifecycleRule{
+			ID:     aws.String(rule.ID),
+			Status: aws.String(s3.ExpirationStatusEnabled),
+			Filter: lifecycleFilterToAws(rule.Prefix, rule.Tags),
+		}
+		if rule.Enabled != nil && !*rule.Enabled {
+			awsRule.Status = aws.String(s3.ExpirationStatusDisabled)
+		}
+		if rule.ExpirationDays != nil {
+			awsRule.Expiration = &s3.LifecycleExpiration{Days: rule.ExpirationDays}
+		}
+		if rule.NoncurrentVersionExpirationDays != nil {
+			awsRule.NoncurrentVersionExpiration = &s3.NoncurrentVersionExpiration{NoncurrentDays: rule.NoncurrentVersionExpirationDays}
+		}
+		for _, transition := range rule.Transitions {
+			awsRule.Transitions = append(awsRule.Transitions, &s3.Transition{
+				Days:         aws.Int64(transition.Days),
+				StorageClass: aws.String(transition.StorageClass),
+			})
+		}
+		if rule.AbortIncompleteMultipartUploadDays != nil {
+			awsRule.AbortIncompleteMultipartUpload = &s3.AbortIncompleteMultipartUpload{DaysAfterInitiation: rule.AbortIncompleteMultipartUploadDays}
+		}
+		awsRules = append(awsRules, awsRule)
+	}
+	return awsRules
+}
+
+// lifecycleFilterToAws uses the simplest filter that aws accepts, And is required for more than one condition
+func lifecycleFilterToAws(prefix string, tags map[string]string) *s3.LifecycleRuleFilter {
+	if len(tags) == 0 {
+		return &s3.LifecycleRuleFilter{Prefix: aws.String(prefix)}
+	}
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	awsTags := make([]*s3.Tag, 0, len(keys))
+	for _, key := range keys {
+		awsTags = append(awsTags, &s3.Tag{Key: aws.String(key), Value: aws.String(tags[key])})
+	}
+	if len(awsTags) == 1 && prefix == "" {
+		return &s3.LifecycleRuleFilter{Tag: awsTags[0]}
+	}
+	and := &s3.LifecycleRuleAndOperator{Tags: awsTags}
+	if prefix != "" {
+		and.Prefix = aws.String(prefix)
+	}
+	return &s3.LifecycleRuleFilter{And: and}
+}
+
+func lifecycleRulesFromAws(awsRules []*s3.LifecycleRule) []s3operatorv1.LifecycleRule {
+	rules := make([]s3operatorv1.LifecycleRule, 0, len(awsRules))
+	for _, awsRule := range awsRules {
+		rule := s3operatorv1.LifecycleRule{
+			ID:      aws.StringValue(awsRule.ID),
+			Enabled: aws.Bool(aws.StringValue(awsRule.Status) == s3.ExpirationStatusEnabled),
+			Prefix:  aws.StringValue(awsRule.Prefix),
+		}
+		if filter := awsRule.Filter; filter != nil {
+			if filter.Prefix != nil {
+				rule.Prefix = *filter.Prefix
+			}
+			if filter.Tag != nil {
+				rule.Tags = map[string]string{aws.StringValue(filter.Tag.Key): aws.StringValue(filter.Tag.Value)}
+			}
+			if filter.And != nil {
+				rule.Prefix = aws.StringValue(filter.And.Prefix)
+				for _, tag := range filter.And.Tags {
+					if rule.Tags == nil {
+						rule.Tags = map[string]string{}
+					}
+					rule.Tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+				}
+			}
+		}
+		if awsRule.Expiration != nil && awsRule.Expiration.Days != nil {
+			rule.ExpirationDays = aws.Int64(*awsRule.Expiration.Days)
+		}
+		if awsRule.NoncurrentVersionExpiration != nil && awsRule.NoncurrentVersionExpiration.NoncurrentDays != nil {
+			rule.NoncurrentVersionExpirationDays = aws.Int64(*awsRule.NoncurrentVersionExpiration.NoncurrentDays)
+		}
+		for _, transition := range awsRule.Transitions {
+			rule.Transitions = append(rule.Transitions, s3operatorv1.LifecycleTransition{
+				Days:         aws.Int64Value(transition.Days),
+				StorageClass: aws.StringValue(transition.StorageClass),
+			})
+		}
+		if awsRule.AbortIncompleteMultipartUpload != nil && awsRule.AbortIncompleteMultipartUpload.DaysAfterInitiation != nil {
+			rule.AbortIncompleteMultipartUploadDays = aws.Int64(*awsRule.AbortIncompleteMultipartUpload.DaysAfterInitiation)
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// isLifecycleRulesEqual compares the rules regardless of their order and of unset defaults
+func isLifecycleRulesEqual(desired []s3operatorv1.LifecycleRule, current []s3operatorv1.LifecycleRule) bool {
+	return reflect.DeepEqual(normalizeLifecycleRules(desired), normalizeLifecycleRules(current))
+}
+
+func normalizeLifecycleRules(rules []s3operatorv1.LifecycleRule) []s3operatorv1.LifecycleRule {
+	normalized := make([]s3operatorv1.LifecycleRule, 0, len(rules))
+	for _, rule := range rules {
+		rule := *rule.DeepCopy()
+		if rule.Enabled == nil {
+			rule.Enabled = aws.Bool(true)
+		}
+		if len(rule.Tags) == 0 {
+			rule.Tags = nil
+		}
+		if len(rule.Transitions) == 0 {
+			rule.Transitions = nil
+		}
+		sort.Slice(rule.Transitions, func(i, j int) bool { return rule.Transitions[i].Days < rule.Transitions[j].Days })
+		normalized = append(normalized, rule)
+	}
+	sort.Slice(normalized, func(i, j int) bool { return normalized[i].ID < normalized[j].ID })
+	return normalized
+}
@@ -0,0 +1,59 @@
+package aws
+
+import (
+	"testing"
+
+	s3operatorv1 "github.com/PayU/K8s-S3-Operator/api/v1"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	. "github.com/onsi/gomega"
+)
+
+// unit test , test translation of lifecycle rules to aws and drift detection
+
+func TestLifecycleFilterToAws(t *testing.T) {
+	g := NewWithT(t)
+
+	filter := lifecycleFilterToAws("logs/", nil)
+	g.Expect(aws.StringValue(filter.Prefix)).To(Equal("logs/"))
+	g.Expect(filter.Tag).To(BeNil())
+	g.Expect(filter.And).To(BeNil())
+
+	filter = lifecycleFilterToAws("", map[string]string{"tier": "cold"})
+	g.Expect(filter.Prefix).To(BeNil())
+	g.Expect(aws.StringValue(filter.Tag.Key)).To(Equal("tier"))
+
+	filter = lifecycleFilterToAws("logs/", map[string]string{"tier": "cold"})
+	g.Expect(filter.Tag).To(BeNil())
+	g.Expect(aws.StringValue(filter.And.Prefix)).To(Equal("logs/"))
+	g.Expect(filter.And.Tags).To(HaveLen(1))
+}
+
+func TestLifecycleRulesRoundTripHasNoDrift(t *testing.T) {
+	g := NewWithT(t)
+	rules := []s3operatorv1.LifecycleRule{
+		{
+			ID:                                 "expire-logs",
+			Prefix:                             "logs/",
+			Tags:                               map[string]string{"tier": "cold", "team": "payments"},
+			ExpirationDays:                     aws.Int64(365),
+			NoncurrentVersionExpirationDays:    aws.Int64(30),
+			Transitions:                        []s3operatorv1.LifecycleTransition{{Days: 90, StorageClass: s3.TransitionStorageClassGlacier}, {Days: 30, StorageClass: s3.TransitionStorageClassStandardIa}},
+			AbortIncompleteMultipartUploadDays: aws.Int64(7),
+		},
+		{ID: "disabled", Enabled: aws.Bool(false), ExpirationDays: aws.Int64(1)},
+	}
+
+	fromAws := lifecycleRulesFromAws(lifecycleRulesToAws(rules))
+	g.Expect(isLifecycleRulesEqual(rules, fromAws)).To(BeTrue())
+}
+
+func TestLifecycleRulesDrift(t *testing.T) {
+	g := NewWithT(t)
+	rules := []s3operatorv1.LifecycleRule{{ID: "expire", ExpirationDays: aws.Int64(10)}}
+	changed := []s3operatorv1.LifecycleRule{{ID: "expire", ExpirationDays: aws.Int64(20)}}
+
+	g.Expect(isLifecycleRulesEqual(rules, changed)).To(BeFalse())
+	g.Expect(isLifecycleRulesEqual(rules, []s3operatorv1.LifecycleRule{})).To(BeFalse())
+	g.Expect(isLifecycleRulesEqual(nil, []s3operatorv1.LifecycleRule{})).To(BeTrue())
+}
@@ -0,0 +1,234 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+
+	s3operatorv1 "github.com/PayU/K8s-S3-Operator/api/v1"
+	"github.com/PayU/K8s-S3-Operator/controllers/config"
+	"github.com/PayU/K8s-S3-Operator/controllers/dryrun"
+	"github.com/PayU/K8s-S3-Operator/controllers/errorkind"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// names of the bucket creation steps, in the order they run
+const (
+	StepCreateBucket      = "CreateBucket"
+	StepTagging           = "Tagging"
+	StepPublicAccessBlock = "PublicAccessBlock"
+	StepEncryption        = "Encryption"
+	StepVersioning        = "Versioning"
+	StepLifecycle         = "Lifecycle"
+	StepCors              = "Cors"
+	StepIamRole           = "IamRole"
+	StepRolePolicy        = "RolePolicy"
+	StepBucketPolicy      = "BucketPolicy"
+)
+
+// creationStep is an idempotent step of the bucket creation, it records its own condition in the status
+type creationStep struct {
+	name string
+	// service that the step calls, reported in the plan of a dry-run reconcile
+	service string
+	run     func(a *AwsClient, ctx context.Context, s3Bucket *s3operatorv1.S3Bucket) error
+}
+
+// creationSteps are ordered so the bucket gets the managed tag right after it is created,
+// a bucket that was created by a failed creation can always be resumed or rolled back
+var creationSteps = []creationStep{
+	{name: StepCreateBucket, service: s3.ServiceName, run: (*AwsClient).createBucketStep},
+	{name: StepTagging, service: s3.ServiceName, run: func(a *AwsClient, ctx context.Context, s3Bucket *s3operatorv1.S3Bucket) error {
+		_, err := a.putBucketTagging(ctx, s3Bucket.Name, &s3Bucket.Spec.Tags)
+		s3Bucket.Status.SetCondition(s3operatorv1.ConditionTaggingApplied, s3Bucket.Generation, err)
+		return err
+	}},
+	{name: StepPublicAccessBlock, service: s3.ServiceName, run: func(a *AwsClient, ctx context.Context, s3Bucket *s3operatorv1.S3Bucket) error {
+		publicAccessBlock, err := publicAccessBlockFromSpec(s3Bucket.Spec.PublicAccess, config.ForbidPublicAccess())
+		if err == nil {
+			err = a.putBucketPublicAccessBlock(ctx, s3Bucket.Name, publicAccessBlock)
+		}
+		s3Bucket.Status.SetCondition(s3operatorv1.ConditionPublicAccessApplied, s3Bucket.Generation, err)
+		return err
+	}},
+	{name: StepEncryption, service: s3.ServiceName, run: func(a *AwsClient, ctx context.Context, s3Bucket *s3operatorv1.S3Bucket) error {
+		if s3Bucket.Spec.GetEncryption() == nil {
+			meta.SetStatusCondition(&s3Bucket.Status.Conditions, metav1.Condition{Type: s3operatorv1.ConditionEncryptionApplied,
+				Status: metav1.ConditionFalse, Reason: s3operatorv1.ReasonNotRequested, ObservedGeneration: s3Bucket.Generation})
+			return nil
+		}
+		_, err := a.putBucketEncrypt(ctx, s3Bucket.Name, s3Bucket.Spec.GetEncryption())
+		s3Bucket.Status.SetCondition(s3operatorv1.ConditionEncryptionApplied, s3Bucket.Generation, err)
+		return err
+	}},
+	{name: StepVersioning, service: s3.ServiceName, run: func(a *AwsClient, ctx context.Context, s3Bucket *s3operatorv1.S3Bucket) error {
+		if s3Bucket.Spec.Versioning == "" {
+			return nil
+		}
+		err := a.putBucketVersioning(ctx, s3Bucket.Name, s3Bucket.Spec.Versioning)
+		s3Bucket.Status.SetCondition(s3operatorv1.ConditionVersioningApplied, s3Bucket.Generation, err)
+		return err
+	}},
+	{name: StepLifecycle, service: s3.ServiceName, run: func(a *AwsClient, ctx context.Context, s3Bucket *s3operatorv1.S3Bucket) error {
+		if len(s3Bucket.Spec.LifecycleRules) == 0 {
+			return nil
+		}
+		err := a.putBucketLifecycle(ctx, s3Bucket.Name, s3Bucket.Spec.LifecycleRules)
+		s3Bucket.Status.SetCondition(s3operatorv1.ConditionLifecycleApplied, s3Bucket.Generation, err)
+		return err
+	}},
+	{name: StepCors, service: s3.ServiceName, run: func(a *AwsClient, ctx context.Context, s3Bucket *s3operatorv1.S3Bucket) error {
+		if len(s3Bucket.Spec.Cors) == 0 {
+			return nil
+		}
+		err := a.putBucketCors(ctx, s3Bucket.Name, s3Bucket.Spec.Cors)
+		s3Bucket.Status.SetCondition(s3operatorv1.ConditionCorsApplied, s3Bucket.Generation, err)
+		return err
+	}},
+	{name: StepIamRole, service: iam.ServiceName, run: func(a *AwsClient, ctx context.Context, s3Bucket *s3operatorv1.S3Bucket) error {
+		roleArn, err := a.createBucketRole(ctx, s3Bucket)
+		s3Bucket.Status.SetCondition(s3operatorv1.ConditionIAMRoleReady, s3Bucket.Generation, err)
+		if err == nil && !isExistingRole(&s3Bucket.Spec) {
+			a.Recorder.Eventf(s3Bucket, corev1.EventTypeNormal, s3operatorv1.EventRoleCreated, "iam role %s was created", roleArn)
+		}
+		return err
+	}},
+	{name: StepRolePolicy, service: iam.ServiceName, run: func(a *AwsClient, ctx context.Context, s3Bucket *s3operatorv1.S3Bucket) error {
+		roleName, err := a.GetRoleName(s3Bucket)
+		if err == nil {
+			_, err = a.updateRolePolicy(ctx, roleName, s3Bucket.Name, &s3Bucket.Spec)
+		}
+		s3Bucket.Status.SetCondition(s3operatorv1.ConditionIAMRoleReady, s3Bucket.Generation, err)
+		return err
+	}},
+	{name: StepBucketPolicy, service: s3.ServiceName, run: func(a *AwsClient, ctx context.Context, s3Bucket *s3operatorv1.S3Bucket) error {
+		_, err := a.putBucketPolicy(ctx, s3Bucket.Name, s3Bucket.Status.IamRoleArn, s3Bucket.Spec.Access)
+		s3Bucket.Status.SetCondition(s3operatorv1.ConditionPolicyApplied, s3Bucket.Generation, err)
+		if err == nil {
+			a.Recorder.Eventf(s3Bucket, corev1.EventTypeNormal, s3operatorv1.EventPolicyApplied,
+				"bucket policy was applied for iam role %s", s3Bucket.Status.IamRoleArn)
+		}
+		return err
+	}},
+}
+
+// planBucketCreation adds the creation steps that did not run yet to the plan of a dry-run reconcile.
+// the steps are not run, since every step depends on the resources that the steps before it create
+func (a *AwsClient) planBucketCreation(s3Bucket *s3operatorv1.S3Bucket, plan *dryrun.Plan) error {
+	roleName, err := a.GetRoleName(s3Bucket)
+	if err != nil {
+		return err
+	}
+	for _, step := range creationSteps[getCreationStepIndex(s3Bucket.Status.ProvisioningStep):] {
+		if !isCreationStepRequested(step.name, &s3Bucket.Spec) {
+			continue
+		}
+		resource := s3Bucket.Name
+		if step.service == iam.ServiceName {
+			resource = roleName
+		}
+		plan.Add(step.service, step.name, resource)
+	}
+	return nil
+}
+
+// isCreationStepRequested is false for the optional steps that the spec does not ask for
+func isCreationStepRequested(stepName string, spec *s3operatorv1.S3BucketSpec) bool {
+	switch stepName {
+	case StepEncryption:
+		return spec.GetEncryption() != nil
+	case StepVersioning:
+		return spec.Versioning != ""
+	case StepLifecycle:
+		return len(spec.LifecycleRules) > 0
+	case StepCors:
+		return len(spec.Cors) > 0
+	}
+	return true
+}
+
+// IsBucketProvisioned is false when the operator never created the bucket or managed it, e.g. its creation failed
+// because the name belongs to another account. such a bucket has no aws resources of the operator to clean up
+func IsBucketProvisioned(status *s3operatorv1.S3BucketStatus) bool {
+	if status.Status == config.STATUS_READY || getCreationStepIndex(status.ProvisioningStep) > getCreationStepIndex(StepCreateBucket) {
+		return true
+	}
+	// the tagging condition is set only on a bucket that has the managed tag, by the creation or by the update
+	return meta.IsStatusConditionTrue(status.Conditions, s3operatorv1.ConditionBucketCreated) ||
+		meta.FindStatusCondition(status.Conditions, s3operatorv1.ConditionTaggingApplied) != nil
+}
+
+// getCreationStepIndex returns the index of the step, the first step is returned for an unknown step
+func getCreationStepIndex(stepName string) int {
+	for i, step := range creationSteps {
+		if step.name == stepName {
+			return i
+		}
+	}
+	return 0
+}
+
+func (a *AwsClient) createBucketStep(ctx context.Context, s3Bucket *s3operatorv1.S3Bucket) error {
+	log := logr.FromContextOrDiscard(ctx)
+	bucketInput := a.createBucketInput(s3Bucket.Name, config.Region())
+	_, err := a.createBucket(ctx, *bucketInput)
+	if awsErr, isAwsErr := err.(awserr.Error); isAwsErr && awsErr.Code() == s3.ErrCodeBucketAlreadyOwnedByYou {
+		// the bucket was created by a previous run of the step that stopped before it finished
+		log.Info("bucket was already created by the operator, continue with it")
+		err = nil
+	}
+	s3Bucket.Status.SetCondition(s3operatorv1.ConditionBucketCreated, s3Bucket.Generation, err)
+	if err != nil {
+		log.Error(err, "got error in create bucket function")
+		return err
+	}
+	s3Bucket.Status.BucketArn = a.GetBucketArn(s3Bucket.Name)
+	s3Bucket.Status.Region = config.Region()
+	s3Bucket.Status.Endpoint = a.getBucketEndpoint(ctx, s3Bucket.Name)
+	a.Recorder.Eventf(s3Bucket, corev1.EventTypeNormal, s3operatorv1.EventBucketCreated, "bucket was created in region %s", config.Region())
+	return nil
+}
+
+// rollbackBucketCreation deletes the role and the bucket that were created by the failed creation,
+// the status is reset so the creation starts from the beginning once the spec is changed, the returned error
+// is terminal so the same spec is not retried. a rollback that fails keeps the status, so it is retried on the next reconcile
+func (a *AwsClient) rollbackBucketCreation(ctx context.Context, s3Bucket *s3operatorv1.S3Bucket) error {
+	log := logr.FromContextOrDiscard(ctx)
+	status := &s3Bucket.Status
+	stepIndex := getCreationStepIndex(status.ProvisioningStep)
+	log.Info("rolling back bucket creation", "provisioning_step", status.ProvisioningStep, "provisioning_failures", status.ProvisioningFailures)
+	if stepIndex > getCreationStepIndex(StepIamRole) || (stepIndex == getCreationStepIndex(StepIamRole) && status.IamRoleArn != "") {
+		roleName, err := a.GetRoleName(s3Bucket)
+		if err == nil {
+			err = a.deleteBucketRole(ctx, roleName, s3Bucket.Name, isExistingRole(&s3Bucket.Spec))
+		}
+		if err != nil {
+			return fmt.Errorf("didnt succeded to rollback bucket creation: %w", err)
+		}
+	}
+	if stepIndex > getCreationStepIndex(StepCreateBucket) {
+		err := a.cleanupsBucketContent(ctx, s3Bucket.Name)
+		if err == nil {
+			_, err = a.deleteBucket(ctx, s3Bucket.Name)
+		}
+		if err != nil {
+			if awsErr, isAwsErr := err.(awserr.Error); !isAwsErr || awsErr.Code() != s3.ErrCodeNoSuchBucket {
+				return fmt.Errorf("didnt succeded to rollback bucket creation: %w", err)
+			}
+		}
+	}
+	rollbackErr := errorkind.Errorf(errorkind.Validation, "bucket creation was rolled back after %d failures of step %s", status.ProvisioningFailures, status.ProvisioningStep)
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{Type: s3operatorv1.ConditionBucketCreated,
+		Status: metav1.ConditionFalse, Reason: s3operatorv1.ReasonRolledBack, Message: rollbackErr.Error(), ObservedGeneration: s3Bucket.Generation})
+	status.ProvisioningStep = ""
+	status.ProvisioningFailures = 0
+	status.BucketArn = ""
+	status.IamRoleArn = ""
+	a.Recorder.Event(s3Bucket, corev1.EventTypeWarning, s3operatorv1.EventCreationRolledBack, rollbackErr.Error())
+	return rollbackErr
+}
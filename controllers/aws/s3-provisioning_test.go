@@ -0,0 +1,169 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	s3operatorv1 "github.com/PayU/K8s-S3-Operator/api/v1"
+	"github.com/PayU/K8s-S3-Operator/controllers/config"
+	"github.com/PayU/K8s-S3-Operator/controllers/dryrun"
+	"github.com/PayU/K8s-S3-Operator/controllers/errorkind"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/go-logr/logr"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestCreationStepsOrder(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(getCreationStepIndex("")).To(Equal(0))
+	g.Expect(getCreationStepIndex("unknown")).To(Equal(0))
+	g.Expect(creationSteps[getCreationStepIndex(StepCreateBucket)+1].name).To(Equal(StepTagging))
+	g.Expect(getCreationStepIndex(StepIamRole)).To(BeNumerically("<", getCreationStepIndex(StepRolePolicy)))
+	g.Expect(creationSteps[len(creationSteps)-1].name).To(Equal(StepBucketPolicy))
+}
+
+func TestCreationIsRolledBackAfterMaxFailures(t *testing.T) {
+	g := NewWithT(t)
+	ctx := logr.NewContext(context.Background(), logr.Discard())
+	recorder := record.NewFakeRecorder(10)
+	awsClient := &AwsClient{Recorder: recorder}
+	s3Bucket := &s3operatorv1.S3Bucket{ObjectMeta: metav1.ObjectMeta{Name: "bucket", Namespace: "team-a", Generation: 1}}
+	s3Bucket.Status.ProvisioningStep = StepCreateBucket
+	s3Bucket.Status.ProvisioningFailures = config.CreationMaxFailures()
+
+	// nothing was created before the create bucket step, so the rollback has no aws call to make
+	err := awsClient.HandleBucketCreation(ctx, s3Bucket)
+	g.Expect(err).To(MatchError(ContainSubstring("rolled back")))
+	kind, isKnown := errorkind.Of(err)
+	g.Expect(isKnown).To(BeTrue())
+	g.Expect(kind.IsTerminal()).To(BeTrue())
+	g.Expect(s3Bucket.Status.ProvisioningStep).To(BeEmpty())
+	g.Expect(s3Bucket.Status.ProvisioningFailures).To(BeZero())
+	condition := meta.FindStatusCondition(s3Bucket.Status.Conditions, s3operatorv1.ConditionBucketCreated)
+	g.Expect(condition).NotTo(BeNil())
+	g.Expect(condition.Reason).To(Equal(s3operatorv1.ReasonRolledBack))
+	g.Expect(recorder.Events).To(Receive(ContainSubstring(s3operatorv1.EventCreationRolledBack)))
+}
+
+func TestCreationIsNotRetriedAfterRollback(t *testing.T) {
+	g := NewWithT(t)
+	ctx := logr.NewContext(context.Background(), logr.Discard())
+	// the client has no aws and kubernetes clients, a creation that starts again would panic
+	awsClient := &AwsClient{Recorder: record.NewFakeRecorder(10)}
+	s3Bucket := &s3operatorv1.S3Bucket{ObjectMeta: metav1.ObjectMeta{Name: "bucket", Namespace: "team-a", Generation: 1}}
+	s3Bucket.Status.ProvisioningStep = StepCreateBucket
+	s3Bucket.Status.ProvisioningFailures = config.CreationMaxFailures()
+	g.Expect(awsClient.HandleBucketCreation(ctx, s3Bucket)).To(MatchError(ContainSubstring("rolled back")))
+
+	err := awsClient.HandleBucketCreation(ctx, s3Bucket)
+	g.Expect(err).To(MatchError(ContainSubstring("spec must be changed")))
+	kind, isKnown := errorkind.Of(err)
+	g.Expect(isKnown).To(BeTrue())
+	g.Expect(kind.IsTerminal()).To(BeTrue())
+	g.Expect(s3Bucket.Status.ProvisioningStep).To(BeEmpty())
+
+	// a changed spec starts the creation again, the dry-run plan shows it without running the steps
+	s3Bucket.Generation = 2
+	plan := &dryrun.Plan{}
+	g.Expect(awsClient.HandleBucketCreation(dryrun.NewContext(ctx, plan), s3Bucket)).To(Succeed())
+	g.Expect(plan.Changes()).NotTo(BeEmpty())
+}
+
+func TestInterruptedCreationStepIsNotAFailure(t *testing.T) {
+	g := NewWithT(t)
+	ctx, cancel := context.WithCancel(logr.NewContext(context.Background(), logr.Discard()))
+	cancel()
+	ses := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("eu-central-1"),
+		Endpoint:    aws.String("http://127.0.0.1:1"),
+		Credentials: credentials.AnonymousCredentials,
+	}))
+	s3Bucket := &s3operatorv1.S3Bucket{ObjectMeta: metav1.ObjectMeta{Name: "bucket", Namespace: "team-a", Generation: 1}}
+	k8sClient := newFakeK8sClient(g, s3Bucket)
+	awsClient := &AwsClient{s3Client: s3.New(ses), Recorder: record.NewFakeRecorder(10), k8sClient: k8sClient}
+
+	err := awsClient.HandleBucketCreation(ctx, s3Bucket)
+	g.Expect(err).To(MatchError(ContainSubstring("interrupted")))
+	g.Expect(s3Bucket.Status.ProvisioningStep).To(Equal(StepCreateBucket))
+	g.Expect(s3Bucket.Status.ProvisioningFailures).To(BeZero())
+	// the step was persisted before it ran
+	persisted := &s3operatorv1.S3Bucket{}
+	g.Expect(k8sClient.Get(context.Background(), client.ObjectKeyFromObject(s3Bucket), persisted)).To(Succeed())
+	g.Expect(persisted.Status.ProvisioningStep).To(Equal(StepCreateBucket))
+}
+
+func TestCreateBucketStepContinuesWithOwnedBucket(t *testing.T) {
+	g := NewWithT(t)
+	ctx := logr.NewContext(context.Background(), logr.Discard())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+		fmt.Fprint(w, "<Error><Code>BucketAlreadyOwnedByYou</Code><Message>owned by you</Message></Error>")
+	}))
+	defer server.Close()
+	ses := session.Must(session.NewSession(&aws.Config{
+		Region:           aws.String("eu-central-1"),
+		Endpoint:         aws.String(server.URL),
+		Credentials:      credentials.AnonymousCredentials,
+		S3ForcePathStyle: aws.Bool(true),
+	}))
+	awsClient := &AwsClient{s3Client: s3.New(ses), Recorder: record.NewFakeRecorder(10)}
+	s3Bucket := &s3operatorv1.S3Bucket{ObjectMeta: metav1.ObjectMeta{Name: "bucket", Namespace: "team-a", Generation: 1}}
+
+	g.Expect(awsClient.createBucketStep(ctx, s3Bucket)).To(Succeed())
+	g.Expect(meta.IsStatusConditionTrue(s3Bucket.Status.Conditions, s3operatorv1.ConditionBucketCreated)).To(BeTrue())
+}
+
+func newFakeK8sClient(g *WithT, objects ...client.Object) client.Client {
+	scheme := runtime.NewScheme()
+	g.Expect(s3operatorv1.AddToScheme(scheme)).To(Succeed())
+	return fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build()
+}
+
+func TestIsBucketProvisioned(t *testing.T) {
+	g := NewWithT(t)
+	status := &s3operatorv1.S3BucketStatus{Status: config.STATUS_FAIL, ProvisioningStep: StepCreateBucket}
+	status.SetCondition(s3operatorv1.ConditionBucketCreated, 1, awserr.New(s3.ErrCodeBucketAlreadyExists, "", nil))
+	g.Expect(IsBucketProvisioned(status)).To(BeFalse())
+
+	status.ProvisioningStep = StepTagging
+	g.Expect(IsBucketProvisioned(status)).To(BeTrue())
+	// a bucket that was provisioned before the conditions were reported
+	g.Expect(IsBucketProvisioned(&s3operatorv1.S3BucketStatus{Status: config.STATUS_READY})).To(BeTrue())
+
+	status = &s3operatorv1.S3BucketStatus{Status: config.STATUS_FAIL}
+	status.SetCondition(s3operatorv1.ConditionTaggingApplied, 1, nil)
+	g.Expect(IsBucketProvisioned(status)).To(BeTrue())
+}
+
+func TestDryRunCreationPlansTheRequestedSteps(t *testing.T) {
+	g := NewWithT(t)
+	plan := &dryrun.Plan{}
+	ctx := dryrun.NewContext(logr.NewContext(context.Background(), logr.Discard()), plan)
+	// the client has no aws clients, a step that runs would panic
+	awsClient := &AwsClient{Recorder: record.NewFakeRecorder(10)}
+	s3Bucket := &s3operatorv1.S3Bucket{ObjectMeta: metav1.ObjectMeta{Name: "bucket", Namespace: "team-a", Generation: 1}}
+	s3Bucket.Spec.Versioning = "Enabled"
+
+	g.Expect(awsClient.HandleBucketCreation(ctx, s3Bucket)).To(Succeed())
+	operations := []string{}
+	for _, change := range plan.Changes() {
+		operations = append(operations, change.Operation)
+	}
+	g.Expect(operations).To(Equal([]string{StepCreateBucket, StepTagging, StepPublicAccessBlock, StepVersioning,
+		StepIamRole, StepRolePolicy, StepBucketPolicy}))
+	g.Expect(s3Bucket.Status.ProvisioningStep).To(BeEmpty())
+}
@@ -0,0 +1,95 @@
+package aws
+
+import (
+	"context"
+	"reflect"
+
+	s3operatorv1 "github.com/PayU/K8s-S3-Operator/api/v1"
+	"github.com/PayU/K8s-S3-Operator/controllers/config"
+	"github.com/PayU/K8s-S3-Operator/controllers/errorkind"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/go-logr/logr"
+)
+
+const errCodeNoSuchPublicAccessBlockConfiguration = "NoSuchPublicAccessBlockConfiguration"
+
+// publicAccessBlockFromSpec enables every flag that the spec does not relax explicitly,
+// relaxing a flag returns an error when public access is forbidden by the operator config
+func publicAccessBlockFromSpec(publicAccess *s3operatorv1.PublicAccessBlock, forbidPublicAccess bool) (*s3.PublicAccessBlockConfiguration, error) {
+	publicAccessBlock := &s3.PublicAccessBlockConfiguration{
+		BlockPublicAcls:       aws.Bool(true),
+		IgnorePublicAcls:      aws.Bool(true),
+		BlockPublicPolicy:     aws.Bool(true),
+		RestrictPublicBuckets: aws.Bool(true),
+	}
+	if publicAccess == nil {
+		return publicAccessBlock, nil
+	}
+	if publicAccess.BlockPublicAcls != nil {
+		publicAccessBlock.BlockPublicAcls = aws.Bool(*publicAccess.BlockPublicAcls)
+	}
+	if publicAccess.IgnorePublicAcls != nil {
+		publicAccessBlock.IgnorePublicAcls = aws.Bool(*publicAccess.IgnorePublicAcls)
+	}
+	if publicAccess.BlockPublicPolicy != nil {
+		publicAccessBlock.BlockPublicPolicy = aws.Bool(*publicAccess.BlockPublicPolicy)
+	}
+	if publicAccess.RestrictPublicBuckets != nil {
+		publicAccessBlock.RestrictPublicBuckets = aws.Bool(*publicAccess.RestrictPublicBuckets)
+	}
+	isRelaxed := !*publicAccessBlock.BlockPublicAcls || !*publicAccessBlock.IgnorePublicAcls ||
+		!*publicAccessBlock.BlockPublicPolicy || !*publicAccessBlock.RestrictPublicBuckets
+	if isRelaxed && forbidPublicAccess {
+		return nil, errorkind.New(errorkind.Validation, "relaxing the public access block is forbidden by the operator configuration")
+	}
+	return publicAccessBlock, nil
+}
+
+func (a *AwsClient) putBucketPublicAccessBlock(ctx context.Context, bucketName string, publicAccessBlock *s3.PublicAccessBlockConfiguration) error {
+	log := logr.FromContextOrDiscard(ctx)
+	log.Info("PutPublicAccessBlock function", "public_access_block", publicAccessBlock)
+	_, err := a.s3Client.PutPublicAccessBlockWithContext(ctx, &s3.PutPublicAccessBlockInput{
+		Bucket:                         aws.String(bucketName),
+		PublicAccessBlockConfiguration: publicAccessBlock,
+	})
+	if err != nil {
+		log.Error(err, "error from PutPublicAccessBlock")
+		return err
+	}
+	log.Info("succeded to put bucket public access block")
+	return nil
+}
+
+// updateBucketPublicAccessBlock compares the public access block in aws to the spec and corrects it,
+// the returned bool is true when the public access block was changed
+func (a *AwsClient) updateBucketPublicAccessBlock(ctx context.Context, bucketName string, publicAccess *s3operatorv1.PublicAccessBlock) (bool, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	log.V(1).Info("UpdateBucketPublicAccessBlock function")
+	publicAccessBlock, err := publicAccessBlockFromSpec(publicAccess, config.ForbidPublicAccess())
+	if err != nil {
+		return false, err
+	}
+	currentPublicAccessBlock := &s3.PublicAccessBlockConfiguration{
+		BlockPublicAcls:       aws.Bool(false),
+		IgnorePublicAcls:      aws.Bool(false),
+		BlockPublicPolicy:     aws.Bool(false),
+		RestrictPublicBuckets: aws.Bool(false),
+	}
+	res, err := a.s3Client.GetPublicAccessBlockWithContext(ctx, &s3.GetPublicAccessBlockInput{Bucket: aws.String(bucketName)})
+	if err != nil {
+		if awsErr, isAwsErr := err.(awserr.Error); !isAwsErr || awsErr.Code() != errCodeNoSuchPublicAccessBlockConfiguration {
+			log.Error(err, "error from GetPublicAccessBlock")
+			return false, err
+		}
+	} else {
+		currentPublicAccessBlock = res.PublicAccessBlockConfiguration
+	}
+	if reflect.DeepEqual(publicAccessBlock, currentPublicAccessBlock) {
+		log.V(1).Info("no public access block to update")
+		return false, nil
+	}
+	log.Info("found public access block to update", "current_public_access_block", currentPublicAccessBlock)
+	return true, a.putBucketPublicAccessBlock(ctx, bucketName, publicAccessBlock)
+}
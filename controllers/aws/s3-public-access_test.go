@@ -0,0 +1,60 @@
+package aws
+
+import (
+	"testing"
+
+	s3operatorv1 "github.com/PayU/K8s-S3-Operator/api/v1"
+	"github.com/PayU/K8s-S3-Operator/controllers/errorkind"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	. "github.com/onsi/gomega"
+)
+
+func TestPublicAccessBlockFromSpec(t *testing.T) {
+	blockAll := &s3.PublicAccessBlockConfiguration{
+		BlockPublicAcls:       aws.Bool(true),
+		IgnorePublicAcls:      aws.Bool(true),
+		BlockPublicPolicy:     aws.Bool(true),
+		RestrictPublicBuckets: aws.Bool(true),
+	}
+	tests := []struct {
+		name               string
+		publicAccess       *s3operatorv1.PublicAccessBlock
+		forbidPublicAccess bool
+		publicAccessBlock  *s3.PublicAccessBlockConfiguration
+		isForbidden        bool
+	}{
+		{name: "unset blocks everything", publicAccess: nil, publicAccessBlock: blockAll},
+		{name: "unset blocks everything when forbidden", publicAccess: nil, forbidPublicAccess: true, publicAccessBlock: blockAll},
+		{name: "empty blocks everything", publicAccess: &s3operatorv1.PublicAccessBlock{}, publicAccessBlock: blockAll},
+		{name: "explicit block is allowed when forbidden", forbidPublicAccess: true, publicAccessBlock: blockAll,
+			publicAccess: &s3operatorv1.PublicAccessBlock{BlockPublicAcls: aws.Bool(true), BlockPublicPolicy: aws.Bool(true)}},
+		{name: "relaxed flags are kept and the rest is blocked",
+			publicAccess: &s3operatorv1.PublicAccessBlock{BlockPublicPolicy: aws.Bool(false), RestrictPublicBuckets: aws.Bool(false)},
+			publicAccessBlock: &s3.PublicAccessBlockConfiguration{
+				BlockPublicAcls:       aws.Bool(true),
+				IgnorePublicAcls:      aws.Bool(true),
+				BlockPublicPolicy:     aws.Bool(false),
+				RestrictPublicBuckets: aws.Bool(false),
+			}},
+		{name: "relaxed policy is forbidden", forbidPublicAccess: true, isForbidden: true,
+			publicAccess: &s3operatorv1.PublicAccessBlock{BlockPublicPolicy: aws.Bool(false)}},
+		{name: "relaxed acls are forbidden", forbidPublicAccess: true, isForbidden: true,
+			publicAccess: &s3operatorv1.PublicAccessBlock{IgnorePublicAcls: aws.Bool(false)}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := NewWithT(t)
+			publicAccessBlock, err := publicAccessBlockFromSpec(test.publicAccess, test.forbidPublicAccess)
+			if test.isForbidden {
+				g.Expect(publicAccessBlock).To(BeNil())
+				kind, isKnown := errorkind.Of(err)
+				g.Expect(isKnown).To(BeTrue())
+				g.Expect(kind).To(Equal(errorkind.Validation))
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(publicAccessBlock).To(Equal(test.publicAccessBlock))
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package aws
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/go-logr/logr"
+)
+
+func (a *AwsClient) putBucketVersioning(ctx context.Context, bucketName string, versioning string) error {
+	log := logr.FromContextOrDiscard(ctx)
+	log.Info("PutBucketVersioning function", "versioning", versioning)
+	_, err := a.s3Client.PutBucketVersioningWithContext(ctx, &s3.PutBucketVersioningInput{
+		Bucket:                  aws.String(bucketName),
+		VersioningConfiguration: &s3.VersioningConfiguration{Status: aws.String(versioning)},
+	})
+	if err != nil {
+		log.Error(err, "error from PutBucketVersioning", "versioning", versioning)
+		return err
+	}
+	log.Info("succeded to put bucket versioning", "versioning", versioning)
+	return nil
+}
+
+// updateBucketVersioning compares the versioning state in aws to the spec and corrects it,
+// the returned bool is true when the versioning was changed
+func (a *AwsClient) updateBucketVersioning(ctx context.Context, bucketName string, versioning string) (bool, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	log.V(1).Info("UpdateBucketVersioning function")
+	res, err := a.s3Client.GetBucketVersioningWithContext(ctx, &s3.GetBucketVersioningInput{Bucket: aws.String(bucketName)})
+	if err != nil {
+		log.Error(err, "error from GetBucketVersioning")
+		return false, err
+	}
+	currentVersioning := aws.StringValue(res.Status)
+	// bucket that versioning was never enabled on has empty status, same as suspended
+	if currentVersioning == versioning || (currentVersioning == "" && versioning == s3.BucketVersioningStatusSuspended) {
+		log.V(1).Info("no versioning to update", "versioning", versioning)
+		return false, nil
+	}
+	log.Info("found versioning to update", "from", currentVersioning, "to", versioning)
+	return true, a.putBucketVersioning(ctx, bucketName, versioning)
+}
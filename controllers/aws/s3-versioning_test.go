@@ -0,0 +1,51 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/go-logr/logr"
+	. "github.com/onsi/gomega"
+)
+
+func TestUpdateBucketVersioning(t *testing.T) {
+	ctx := logr.NewContext(context.Background(), logr.Discard())
+	tests := []struct {
+		name              string
+		currentVersioning string
+		versioning        string
+		isChanged         bool
+	}{
+		{name: "never enabled is suspended", currentVersioning: "", versioning: s3.BucketVersioningStatusSuspended, isChanged: false},
+		{name: "never enabled is enabled", currentVersioning: "", versioning: s3.BucketVersioningStatusEnabled, isChanged: true},
+		{name: "enabled in sync", currentVersioning: s3.BucketVersioningStatusEnabled, versioning: s3.BucketVersioningStatusEnabled, isChanged: false},
+		{name: "enabled is suspended", currentVersioning: s3.BucketVersioningStatusEnabled, versioning: s3.BucketVersioningStatusSuspended, isChanged: true},
+		{name: "suspended is enabled", currentVersioning: s3.BucketVersioningStatusSuspended, versioning: s3.BucketVersioningStatusEnabled, isChanged: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := NewWithT(t)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodGet {
+					fmt.Fprintf(w, "<VersioningConfiguration><Status>%s</Status></VersioningConfiguration>", test.currentVersioning)
+				}
+			}))
+			defer server.Close()
+			operations := []string{}
+			awsClient := newRecordingAwsClient(server, &operations)
+
+			isChanged, err := awsClient.updateBucketVersioning(ctx, "bucket", test.versioning)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(isChanged).To(Equal(test.isChanged))
+			if test.isChanged {
+				g.Expect(operations).To(Equal([]string{"GetBucketVersioning", "PutBucketVersioning"}))
+			} else {
+				g.Expect(operations).To(Equal([]string{"GetBucketVersioning"}))
+			}
+		})
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"text/template"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -25,8 +27,36 @@ var waitBackoffSteps int64
 var pathToToken string
 var SERVICE_ACCOUNT_APPROVAL_URL string
 var configMapName string
+var defaultDeletionPolicy string
+var forbidPublicAccess bool
+var dryRun bool
+var dryRunOrphanOnDelete bool
+var oidcIssuer string
+var awsAccountId string
+var clusterName string
+var awsPartition string
+var roleNameTemplate *template.Template
+var rolePath string
+var permissionsBoundaryArn string
+var roleMaxSessionDuration int64
+var creationMaxFailures int64
+var resyncPeriod time.Duration
+var tracingEnabled bool
+var maxConcurrentReconciles int64
+var awsOperationTimeout time.Duration
+var awsOperationTimeouts = map[string]time.Duration{}
+var reconcileTimeout time.Duration
+var gracefulShutdownTimeout time.Duration
+var tracingEndpoint string
+var requeueBaseDelay time.Duration
+var requeueMaxDelay time.Duration
+var awsRateLimits = map[string]float64{"s3": 50, "iam": 10, "sts": 10}
+var awsRateBursts = map[string]int{"s3": 100, "iam": 20, "sts": 20}
+var awsMaxRetries int
+
 const STATUS_FAIL = "failed"
 const STATUS_READY = "ready"
+const FINALIZER_NAME = "s3operator.payu.com/finalizer"
 
 func init() {
 	var err error
@@ -104,6 +134,146 @@ func init() {
 	if configMapName = os.Getenv("CONFIG_MAP_NAME"); configMapName == "" {
 		configMapName = "k8s-s3-operator-config-map-body"
 	}
+	forbidPublicAccess = os.Getenv("FORBID_PUBLIC_ACCESS") == "true"
+	// in dry-run every bucket only reports the changes it would apply, like with the dry-run annotation
+	dryRun = os.Getenv("DRY_RUN") == "true"
+	// opt-in only, a bucket that is deleted in dry-run loses its finalizer and its bucket and iam role are orphaned in aws
+	dryRunOrphanOnDelete = os.Getenv("DRY_RUN_ORPHAN_ON_DELETE") == "true"
+	oidcIssuer = strings.TrimPrefix(os.Getenv("OIDC_ISSUER"), "https://")
+	awsAccountId = os.Getenv("AWS_ACCOUNT_ID")
+	clusterName = os.Getenv("CLUSTER_NAME")
+	if awsPartition = os.Getenv("AWS_PARTITION"); awsPartition != "" && awsPartition != "aws" && awsPartition != "aws-cn" && awsPartition != "aws-us-gov" {
+		panic(fmt.Sprintf("error on parsing awsPartition:[%v] must be one of aws, aws-cn, aws-us-gov", awsPartition))
+	}
+	strRoleNameTemplate := os.Getenv("ROLE_NAME_TEMPLATE")
+	if strRoleNameTemplate == "" {
+		strRoleNameTemplate = "{{.Bucket}}IAM-ROLE-S3Operator"
+	}
+	if roleNameTemplate, err = template.New("roleName").Option("missingkey=error").Parse(strRoleNameTemplate); err != nil {
+		panic(fmt.Sprintf("error on parsing roleNameTemplate:[%v]", err))
+	}
+	if rolePath = os.Getenv("ROLE_PATH"); rolePath == "" {
+		rolePath = "/s3-operator/"
+		if clusterName != "" {
+			rolePath += clusterName + "/"
+		}
+	} else if !strings.HasPrefix(rolePath, "/") || !strings.HasSuffix(rolePath, "/") {
+		panic(fmt.Sprintf("error on parsing rolePath:[%v] must begin and end with /", rolePath))
+	}
+	permissionsBoundaryArn = os.Getenv("PERMISSIONS_BOUNDARY_ARN")
+	if strMaxSessionDuration := os.Getenv("ROLE_MAX_SESSION_DURATION"); strMaxSessionDuration != "" {
+		roleMaxSessionDuration, err = strconv.ParseInt(strMaxSessionDuration, 10, 64)
+		if err != nil || roleMaxSessionDuration < 3600 || roleMaxSessionDuration > 43200 {
+			panic(fmt.Sprintf("error on parsing roleMaxSessionDuration:[%v] must be between 3600 and 43200 seconds", strMaxSessionDuration))
+		}
+	} else {
+		roleMaxSessionDuration = 3600
+	}
+	if strCreationMaxFailures := os.Getenv("CREATION_MAX_FAILURES"); strCreationMaxFailures != "" {
+		if creationMaxFailures, err = strconv.ParseInt(strCreationMaxFailures, 10, 32); err != nil || creationMaxFailures < 1 {
+			panic(fmt.Sprintf("error on parsing creationMaxFailures:[%v] must be a positive number", strCreationMaxFailures))
+		}
+	} else {
+		creationMaxFailures = 5
+	}
+	if strResyncPeriod := os.Getenv("RESYNC_PERIOD"); strResyncPeriod != "" {
+		if resyncPeriod, err = time.ParseDuration(strResyncPeriod); err != nil || resyncPeriod < 0 {
+			panic(fmt.Sprintf("error on parsing resyncPeriod:[%v]", strResyncPeriod))
+		}
+	} else {
+		resyncPeriod = 10 * time.Minute
+	}
+	if strMaxConcurrentReconciles := os.Getenv("MAX_CONCURRENT_RECONCILES"); strMaxConcurrentReconciles != "" {
+		if maxConcurrentReconciles, err = strconv.ParseInt(strMaxConcurrentReconciles, 10, 32); err != nil || maxConcurrentReconciles < 1 {
+			panic(fmt.Sprintf("error on parsing maxConcurrentReconciles:[%v] must be a positive number", strMaxConcurrentReconciles))
+		}
+	} else {
+		maxConcurrentReconciles = 1
+	}
+	if strAwsOperationTimeout := os.Getenv("AWS_OPERATION_TIMEOUT"); strAwsOperationTimeout != "" {
+		if awsOperationTimeout, err = time.ParseDuration(strAwsOperationTimeout); err != nil || awsOperationTimeout <= 0 {
+			panic(fmt.Sprintf("error on parsing awsOperationTimeout:[%v]", strAwsOperationTimeout))
+		}
+	} else {
+		awsOperationTimeout = 30 * time.Second
+	}
+	// overrides of the timeout for specific operations, in the format DeleteObjects=2m,ListObjectVersions=1m
+	if strAwsOperationTimeouts := os.Getenv("AWS_OPERATION_TIMEOUTS"); strAwsOperationTimeouts != "" {
+		for _, operationTimeout := range strings.Split(strAwsOperationTimeouts, ",") {
+			operation, strTimeout, isFound := strings.Cut(strings.TrimSpace(operationTimeout), "=")
+			timeout, err := time.ParseDuration(strTimeout)
+			if !isFound || operation == "" || err != nil || timeout <= 0 {
+				panic(fmt.Sprintf("error on parsing awsOperationTimeouts:[%v] must be a list of Operation=duration", operationTimeout))
+			}
+			awsOperationTimeouts[operation] = timeout
+		}
+	}
+	// requests per second of each aws service, shared by all the reconciles, in the format s3=50,iam=10,sts=10
+	if strAwsRateLimits := os.Getenv("AWS_RATE_LIMITS"); strAwsRateLimits != "" {
+		for _, serviceLimit := range strings.Split(strAwsRateLimits, ",") {
+			service, strLimit, isFound := strings.Cut(strings.TrimSpace(serviceLimit), "=")
+			limit, err := strconv.ParseFloat(strLimit, 64)
+			if _, isKnown := awsRateLimits[service]; !isFound || !isKnown || err != nil || limit <= 0 {
+				panic(fmt.Sprintf("error on parsing awsRateLimits:[%v] must be a list of service=limit of the services s3, iam and sts", serviceLimit))
+			}
+			awsRateLimits[service] = limit
+		}
+	}
+	// requests of each aws service that can be sent at once, in the format s3=100,iam=20,sts=20
+	if strAwsRateBursts := os.Getenv("AWS_RATE_BURSTS"); strAwsRateBursts != "" {
+		for _, serviceBurst := range strings.Split(strAwsRateBursts, ",") {
+			service, strBurst, isFound := strings.Cut(strings.TrimSpace(serviceBurst), "=")
+			burst, err := strconv.Atoi(strBurst)
+			if _, isKnown := awsRateBursts[service]; !isFound || !isKnown || err != nil || burst < 1 {
+				panic(fmt.Sprintf("error on parsing awsRateBursts:[%v] must be a list of service=burst of the services s3, iam and sts", serviceBurst))
+			}
+			awsRateBursts[service] = burst
+		}
+	}
+	if strAwsMaxRetries := os.Getenv("AWS_MAX_RETRIES"); strAwsMaxRetries != "" {
+		if awsMaxRetries, err = strconv.Atoi(strAwsMaxRetries); err != nil || awsMaxRetries < 0 {
+			panic(fmt.Sprintf("error on parsing awsMaxRetries:[%v]", strAwsMaxRetries))
+		}
+	} else {
+		awsMaxRetries = 3
+	}
+	if strReconcileTimeout := os.Getenv("RECONCILE_TIMEOUT"); strReconcileTimeout != "" {
+		if reconcileTimeout, err = time.ParseDuration(strReconcileTimeout); err != nil || reconcileTimeout <= 0 {
+			panic(fmt.Sprintf("error on parsing reconcileTimeout:[%v]", strReconcileTimeout))
+		}
+	} else {
+		reconcileTimeout = 5 * time.Minute
+	}
+	if strGracefulShutdownTimeout := os.Getenv("GRACEFUL_SHUTDOWN_TIMEOUT"); strGracefulShutdownTimeout != "" {
+		if gracefulShutdownTimeout, err = time.ParseDuration(strGracefulShutdownTimeout); err != nil || gracefulShutdownTimeout < 0 {
+			panic(fmt.Sprintf("error on parsing gracefulShutdownTimeout:[%v]", strGracefulShutdownTimeout))
+		}
+	} else {
+		gracefulShutdownTimeout = 30 * time.Second
+	}
+	if strRequeueBaseDelay := os.Getenv("REQUEUE_BASE_DELAY"); strRequeueBaseDelay != "" {
+		if requeueBaseDelay, err = time.ParseDuration(strRequeueBaseDelay); err != nil || requeueBaseDelay <= 0 {
+			panic(fmt.Sprintf("error on parsing requeueBaseDelay:[%v]", strRequeueBaseDelay))
+		}
+	} else {
+		requeueBaseDelay = 5 * time.Second
+	}
+	if strRequeueMaxDelay := os.Getenv("REQUEUE_MAX_DELAY"); strRequeueMaxDelay != "" {
+		if requeueMaxDelay, err = time.ParseDuration(strRequeueMaxDelay); err != nil || requeueMaxDelay < requeueBaseDelay {
+			panic(fmt.Sprintf("error on parsing requeueMaxDelay:[%v], it must not be lower than the base delay", strRequeueMaxDelay))
+		}
+	} else if requeueMaxDelay = 10 * time.Minute; requeueMaxDelay < requeueBaseDelay {
+		requeueMaxDelay = requeueBaseDelay
+	}
+	tracingEnabled = os.Getenv("TRACING_ENABLED") == "true"
+	if tracingEndpoint = os.Getenv("TRACING_ENDPOINT"); tracingEndpoint == "" {
+		tracingEndpoint = "http://localhost:4318"
+	}
+	if defaultDeletionPolicy = os.Getenv("DEFAULT_DELETION_POLICY"); defaultDeletionPolicy == "" {
+		defaultDeletionPolicy = "Delete"
+	} else if defaultDeletionPolicy != "Delete" && defaultDeletionPolicy != "Retain" && defaultDeletionPolicy != "Orphan" {
+		panic(fmt.Sprintf("error on parsing defaultDeletionPolicy:[%v] must be one of Delete, Retain, Orphan", defaultDeletionPolicy))
+	}
 }
 
 func Timeout() time.Duration {
@@ -156,3 +326,82 @@ func ServiceAccountApprovalUrl() string {
 func ConfigMapName() string {
 	return configMapName
 }
+
+func DefaultDeletionPolicy() string {
+	return defaultDeletionPolicy
+}
+func ForbidPublicAccess() bool {
+	return forbidPublicAccess
+}
+func DryRun() bool {
+	return dryRun
+}
+func DryRunOrphanOnDelete() bool {
+	return dryRunOrphanOnDelete
+}
+func OidcIssuer() string {
+	return oidcIssuer
+}
+func AwsAccountId() string {
+	return awsAccountId
+}
+func ClusterName() string {
+	return clusterName
+}
+func AwsPartition() string {
+	return awsPartition
+}
+func RoleNameTemplate() *template.Template {
+	return roleNameTemplate
+}
+func RolePath() string {
+	return rolePath
+}
+func PermissionsBoundaryArn() string {
+	return permissionsBoundaryArn
+}
+func RoleMaxSessionDuration() int64 {
+	return roleMaxSessionDuration
+}
+func CreationMaxFailures() int32 {
+	return int32(creationMaxFailures)
+}
+func ResyncPeriod() time.Duration {
+	return resyncPeriod
+}
+func MaxConcurrentReconciles() int {
+	return int(maxConcurrentReconciles)
+}
+func AwsOperationTimeout(operation string) time.Duration {
+	if timeout, isFound := awsOperationTimeouts[operation]; isFound {
+		return timeout
+	}
+	return awsOperationTimeout
+}
+func AwsRateLimit(service string) float64 {
+	return awsRateLimits[service]
+}
+func AwsRateBurst(service string) int {
+	return awsRateBursts[service]
+}
+func AwsMaxRetries() int {
+	return awsMaxRetries
+}
+func ReconcileTimeout() time.Duration {
+	return reconcileTimeout
+}
+func GracefulShutdownTimeout() time.Duration {
+	return gracefulShutdownTimeout
+}
+func RequeueBaseDelay() time.Duration {
+	return requeueBaseDelay
+}
+func RequeueMaxDelay() time.Duration {
+	return requeueMaxDelay
+}
+func TracingEnabled() bool {
+	return tracingEnabled
+}
+func TracingEndpoint() string {
+	return tracingEndpoint
+}
@@ -0,0 +1,191 @@
+package dryrun
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	s3operatorv1 "github.com/PayU/K8s-S3-Operator/api/v1"
+	"github.com/PayU/K8s-S3-Operator/controllers/config"
+	"github.com/aws/aws-sdk-go/aws/awsutil"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// maxDetailsLength bounds the details of a planned change, so a large policy does not bloat the status
+const maxDetailsLength = 1024
+
+// maxChanges bounds the number of planned changes, so a plan of many calls does not exceed the size of an object
+const maxChanges = 50
+
+// Plan collects the calls that a dry-run reconcile skipped, it is safe for concurrent use
+type Plan struct {
+	mu      sync.Mutex
+	changes []s3operatorv1.PlannedChange
+	// omitted counts the changes that were added after the plan was full
+	omitted int
+}
+
+func (p *Plan) Add(service string, operation string, details string) {
+	if len(details) > maxDetailsLength {
+		details = details[:maxDetailsLength] + "..."
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.changes) >= maxChanges {
+		p.omitted++
+		return
+	}
+	p.changes = append(p.changes, s3operatorv1.PlannedChange{Service: service, Operation: operation, Details: details})
+}
+
+// Changes returns the planned changes, the changes that did not fit in the plan are summarized by a last change
+func (p *Plan) Changes() []s3operatorv1.PlannedChange {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	changes := append([]s3operatorv1.PlannedChange{}, p.changes...)
+	if p.omitted > 0 {
+		changes = append(changes, s3operatorv1.PlannedChange{Service: "dry-run", Operation: "Omitted",
+			Details: fmt.Sprintf("+%d more changes", p.omitted)})
+	}
+	return changes
+}
+
+type planKey struct{}
+
+// NewContext returns a context of a dry-run reconcile that collects its skipped calls in the plan,
+// the context is returned as it is when the plan is nil
+func NewContext(ctx context.Context, plan *Plan) context.Context {
+	if plan == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, planKey{}, plan)
+}
+
+// FromContext returns the plan of the reconcile, it is nil when the reconcile is not a dry-run
+func FromContext(ctx context.Context) *Plan {
+	plan, _ := ctx.Value(planKey{}).(*Plan)
+	return plan
+}
+
+// IsEnabled is true when the operator runs in dry-run or the resource has the dry-run annotation
+func IsEnabled(object runtime.Object) bool {
+	if config.DryRun() {
+		return true
+	}
+	accessor, err := meta.Accessor(object)
+	return err == nil && accessor.GetAnnotations()[s3operatorv1.DryRunAnnotation] == "true"
+}
+
+// isReadOnlyOperation is true for the aws operations that do not change anything, every other operation is skipped in dry-run
+func isReadOnlyOperation(operation string) bool {
+	for _, prefix := range []string{"Get", "List", "Head", "Describe"} {
+		if strings.HasPrefix(operation, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// SkipAwsMutation is a validate handler of the aws session. in a dry-run reconcile it adds a mutating operation
+// to the plan and replaces its sending with an empty successful response, the read operations are sent as usual
+func SkipAwsMutation(r *request.Request) {
+	plan := FromContext(r.Context())
+	if plan == nil || r.Error != nil || r.Operation == nil || isReadOnlyOperation(r.Operation.Name) {
+		return
+	}
+	plan.Add(r.ClientInfo.ServiceName, r.Operation.Name, strings.Join(strings.Fields(awsutil.Prettify(r.Params)), " "))
+	r.Handlers.Sign.Clear()
+	r.Handlers.Send.Clear()
+	r.Handlers.Send.PushBack(func(r *request.Request) {
+		r.HTTPResponse = &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: http.NoBody}
+	})
+	r.Handlers.UnmarshalMeta.Clear()
+	r.Handlers.ValidateResponse.Clear()
+	r.Handlers.Unmarshal.Clear()
+	r.Handlers.UnmarshalError.Clear()
+}
+
+// Client skips the writes of a dry-run reconcile and adds them to its plan,
+// the reads and the status writes are passed to the wrapped client
+type Client struct {
+	client.Client
+}
+
+func (c Client) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if plan := FromContext(ctx); plan != nil {
+		c.addToPlan(plan, "Create", obj)
+		return nil
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func (c Client) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	if plan := FromContext(ctx); plan != nil {
+		c.addToPlan(plan, "Update", obj)
+		return nil
+	}
+	return c.Client.Update(ctx, obj, opts...)
+}
+
+func (c Client) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if plan := FromContext(ctx); plan != nil {
+		c.addToPlan(plan, "Patch", obj)
+		return nil
+	}
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+func (c Client) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	if plan := FromContext(ctx); plan != nil {
+		c.addToPlan(plan, "Delete", obj)
+		return nil
+	}
+	return c.Client.Delete(ctx, obj, opts...)
+}
+
+func (c Client) DeleteAllOf(ctx context.Context, obj client.Object, opts ...client.DeleteAllOfOption) error {
+	if plan := FromContext(ctx); plan != nil {
+		c.addToPlan(plan, "DeleteAllOf", obj)
+		return nil
+	}
+	return c.Client.DeleteAllOf(ctx, obj, opts...)
+}
+
+func (c Client) addToPlan(plan *Plan, operation string, obj client.Object) {
+	kind := fmt.Sprintf("%T", obj)
+	if gvk, err := apiutil.GVKForObject(obj, c.Scheme()); err == nil {
+		kind = gvk.Kind
+	}
+	plan.Add("kubernetes", operation, fmt.Sprintf("%s %s/%s annotations=%v", kind, obj.GetNamespace(), obj.GetName(), obj.GetAnnotations()))
+}
+
+// Recorder drops the events of the resources in dry-run, since their lifecycle steps did not happen.
+// only the event with the plan is emitted for them
+type Recorder struct {
+	record.EventRecorder
+}
+
+func (r Recorder) Event(object runtime.Object, eventtype string, reason string, message string) {
+	if reason == s3operatorv1.EventDryRunPlanned || !IsEnabled(object) {
+		r.EventRecorder.Event(object, eventtype, reason, message)
+	}
+}
+
+func (r Recorder) Eventf(object runtime.Object, eventtype string, reason string, messageFmt string, args ...interface{}) {
+	if reason == s3operatorv1.EventDryRunPlanned || !IsEnabled(object) {
+		r.EventRecorder.Eventf(object, eventtype, reason, messageFmt, args...)
+	}
+}
+
+func (r Recorder) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventtype string, reason string, messageFmt string, args ...interface{}) {
+	if reason == s3operatorv1.EventDryRunPlanned || !IsEnabled(object) {
+		r.EventRecorder.AnnotatedEventf(object, annotations, eventtype, reason, messageFmt, args...)
+	}
+}
@@ -0,0 +1,100 @@
+package dryrun
+
+import (
+	"context"
+	"testing"
+
+	s3operatorv1 "github.com/PayU/K8s-S3-Operator/api/v1"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestSkipAwsMutation(t *testing.T) {
+	g := NewWithT(t)
+	// nothing listens on the endpoint, only a request that is sent fails
+	ses := session.Must(session.NewSession(&aws.Config{
+		Region:           aws.String("eu-central-1"),
+		Endpoint:         aws.String("http://127.0.0.1:1"),
+		Credentials:      credentials.AnonymousCredentials,
+		S3ForcePathStyle: aws.Bool(true),
+		MaxRetries:       aws.Int(0),
+	}))
+	ses.Handlers.Validate.PushBack(SkipAwsMutation)
+	s3Client := s3.New(ses)
+	plan := &Plan{}
+	ctx := NewContext(context.Background(), plan)
+
+	_, err := s3Client.PutBucketTaggingWithContext(ctx, &s3.PutBucketTaggingInput{
+		Bucket:  aws.String("bucket"),
+		Tagging: &s3.Tagging{TagSet: []*s3.Tag{{Key: aws.String("team"), Value: aws.String("a")}}},
+	})
+	g.Expect(err).NotTo(HaveOccurred())
+	_, err = s3Client.GetBucketTaggingWithContext(ctx, &s3.GetBucketTaggingInput{Bucket: aws.String("bucket")})
+	g.Expect(err).To(HaveOccurred())
+	_, err = s3Client.PutBucketTaggingWithContext(context.Background(), &s3.PutBucketTaggingInput{
+		Bucket:  aws.String("bucket"),
+		Tagging: &s3.Tagging{TagSet: []*s3.Tag{}},
+	})
+	g.Expect(err).To(HaveOccurred())
+
+	changes := plan.Changes()
+	g.Expect(changes).To(HaveLen(1))
+	g.Expect(changes[0].Service).To(Equal("s3"))
+	g.Expect(changes[0].Operation).To(Equal("PutBucketTagging"))
+	g.Expect(changes[0].Details).To(ContainSubstring(`Key: "team"`))
+}
+
+func TestClientSkipsWritesInDryRun(t *testing.T) {
+	g := NewWithT(t)
+	c := Client{Client: fake.NewClientBuilder().Build()}
+	plan := &Plan{}
+	sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "team-a",
+		Annotations: map[string]string{"eks.amazonaws.com/role-arn": "arn:aws:iam::123456789012:role/app"}}}
+
+	g.Expect(c.Create(NewContext(context.Background(), plan), sa)).To(Succeed())
+	err := c.Get(context.Background(), types.NamespacedName{Name: "app", Namespace: "team-a"}, &corev1.ServiceAccount{})
+	g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	g.Expect(plan.Changes()).To(Equal([]s3operatorv1.PlannedChange{{Service: "kubernetes", Operation: "Create",
+		Details: "ServiceAccount team-a/app annotations=map[eks.amazonaws.com/role-arn:arn:aws:iam::123456789012:role/app]"}}))
+
+	g.Expect(c.Create(context.Background(), sa)).To(Succeed())
+	g.Expect(c.Get(context.Background(), types.NamespacedName{Name: "app", Namespace: "team-a"}, &corev1.ServiceAccount{})).To(Succeed())
+}
+
+func TestRecorderDropsEventsInDryRun(t *testing.T) {
+	g := NewWithT(t)
+	fakeRecorder := record.NewFakeRecorder(10)
+	recorder := Recorder{EventRecorder: fakeRecorder}
+	s3Bucket := &s3operatorv1.S3Bucket{ObjectMeta: metav1.ObjectMeta{Name: "bucket",
+		Annotations: map[string]string{s3operatorv1.DryRunAnnotation: "true"}}}
+
+	recorder.Event(s3Bucket, corev1.EventTypeNormal, s3operatorv1.EventBucketCreated, "bucket was created")
+	recorder.Eventf(s3Bucket, corev1.EventTypeNormal, s3operatorv1.EventDryRunPlanned, "dry-run planned %d changes", 1)
+	recorder.Event(&s3operatorv1.S3Bucket{}, corev1.EventTypeNormal, s3operatorv1.EventBucketCreated, "bucket was created")
+
+	g.Expect(fakeRecorder.Events).To(HaveLen(2))
+	g.Expect(<-fakeRecorder.Events).To(ContainSubstring(s3operatorv1.EventDryRunPlanned))
+	g.Expect(<-fakeRecorder.Events).To(ContainSubstring(s3operatorv1.EventBucketCreated))
+}
+
+func TestPlanSummarizesChangesThatDoNotFit(t *testing.T) {
+	g := NewWithT(t)
+	plan := &Plan{}
+	for i := 0; i < maxChanges+3; i++ {
+		plan.Add("s3", "DeleteObjects", "")
+	}
+
+	changes := plan.Changes()
+	g.Expect(changes).To(HaveLen(maxChanges + 1))
+	g.Expect(changes[maxChanges-1].Operation).To(Equal("DeleteObjects"))
+	g.Expect(changes[maxChanges]).To(Equal(s3operatorv1.PlannedChange{Service: "dry-run", Operation: "Omitted", Details: "+3 more changes"}))
+}
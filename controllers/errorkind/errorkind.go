@@ -0,0 +1,80 @@
+package errorkind
+
+import (
+	"errors"
+	"fmt"
+
+	s3operatorv1 "github.com/PayU/K8s-S3-Operator/api/v1"
+)
+
+// Kind classifies the failure of a reconcile, it decides if and when the bucket is reconciled again
+type Kind string
+
+const (
+	// Throttling is a rate limit of aws, the api server or the auth server
+	Throttling Kind = "Throttling"
+	// Transient is a network or server failure that is expected to pass by itself
+	Transient Kind = "Transient"
+	// Conflict is a resource that already exists or that is not owned by the operator
+	Conflict Kind = "Conflict"
+	// Validation is a spec that can not be applied as it is
+	Validation Kind = "Validation"
+	// PermissionDenied is an action that the operator is not allowed to do
+	PermissionDenied Kind = "PermissionDenied"
+	// Unknown is a failure that was not classified, it is retried like a transient failure
+	Unknown Kind = "Unknown"
+)
+
+// IsTerminal is true for failures that retrying can not fix, only a change of the spec or of the environment does
+func (k Kind) IsTerminal() bool {
+	return k == Conflict || k == Validation || k == PermissionDenied
+}
+
+// Reason is the reason of the Ready condition of a bucket that failed with this kind
+func (k Kind) Reason() string {
+	switch k {
+	case Throttling:
+		return s3operatorv1.ReasonThrottled
+	case Transient:
+		return s3operatorv1.ReasonTransientError
+	case Conflict:
+		return s3operatorv1.ReasonConflict
+	case Validation:
+		return s3operatorv1.ReasonInvalidSpec
+	case PermissionDenied:
+		return s3operatorv1.ReasonPermissionDenied
+	default:
+		return s3operatorv1.ReasonFailed
+	}
+}
+
+// Error is a failure that its kind is known where it is raised
+type Error struct {
+	Kind Kind
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func New(kind Kind, text string) error {
+	return &Error{Kind: kind, Err: errors.New(text)}
+}
+
+func Errorf(kind Kind, format string, args ...interface{}) error {
+	return &Error{Kind: kind, Err: fmt.Errorf(format, args...)}
+}
+
+// Of returns the kind of the first Error in the chain of err, the bool is false when there is none
+func Of(err error) (Kind, bool) {
+	var kindErr *Error
+	if errors.As(err, &kindErr) {
+		return kindErr.Kind, true
+	}
+	return Unknown, false
+}
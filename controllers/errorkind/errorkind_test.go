@@ -0,0 +1,36 @@
+package errorkind
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	s3operatorv1 "github.com/PayU/K8s-S3-Operator/api/v1"
+	. "github.com/onsi/gomega"
+)
+
+func TestOfFindsWrappedKind(t *testing.T) {
+	g := NewWithT(t)
+	err := fmt.Errorf("bucket creation step IamRole failed: %w", Errorf(Conflict, "iam role %s already exists", "role"))
+
+	kind, found := Of(err)
+	g.Expect(found).To(BeTrue())
+	g.Expect(kind).To(Equal(Conflict))
+	g.Expect(err.Error()).To(Equal("bucket creation step IamRole failed: iam role role already exists"))
+
+	kind, found = Of(errors.New("connection reset"))
+	g.Expect(found).To(BeFalse())
+	g.Expect(kind).To(Equal(Unknown))
+}
+
+func TestKindIsTerminal(t *testing.T) {
+	g := NewWithT(t)
+	for _, kind := range []Kind{Conflict, Validation, PermissionDenied} {
+		g.Expect(kind.IsTerminal()).To(BeTrue(), string(kind))
+	}
+	for _, kind := range []Kind{Throttling, Transient, Unknown} {
+		g.Expect(kind.IsTerminal()).To(BeFalse(), string(kind))
+	}
+	g.Expect(Validation.Reason()).To(Equal(s3operatorv1.ReasonInvalidSpec))
+	g.Expect(Unknown.Reason()).To(Equal(s3operatorv1.ReasonFailed))
+}
@@ -0,0 +1,55 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/PayU/K8s-S3-Operator/controllers/errorkind"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// ErrorKind classifies an error that was returned by the k8s client, errors of the operator
+// and of the auth server are classified where they are raised and api errors by their reason
+func ErrorKind(err error) errorkind.Kind {
+	if kind, found := errorkind.Of(err); found {
+		return kind
+	}
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded), errors.Is(err, wait.ErrWaitTimeout):
+		return errorkind.Transient
+	case apierrors.IsTooManyRequests(err):
+		return errorkind.Throttling
+	// a conflict of the api server is an update of an old version of the object, the next reconcile reads it again
+	case apierrors.IsConflict(err), apierrors.IsServerTimeout(err), apierrors.IsTimeout(err),
+		apierrors.IsServiceUnavailable(err), apierrors.IsInternalError(err), apierrors.IsUnexpectedServerError(err):
+		return errorkind.Transient
+	case apierrors.IsAlreadyExists(err):
+		return errorkind.Conflict
+	case apierrors.IsForbidden(err), apierrors.IsUnauthorized(err):
+		return errorkind.PermissionDenied
+	case apierrors.IsInvalid(err), apierrors.IsBadRequest(err):
+		return errorkind.Validation
+	case errors.As(err, &netErr):
+		return errorkind.Transient
+	}
+	return errorkind.Unknown
+}
+
+// authServerErrorKind classifies a response of the auth server that is not OK by its status code
+func authServerErrorKind(statusCode int) errorkind.Kind {
+	switch {
+	case statusCode == http.StatusTooManyRequests:
+		return errorkind.Throttling
+	case statusCode >= http.StatusInternalServerError:
+		return errorkind.Transient
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		return errorkind.PermissionDenied
+	case statusCode == http.StatusBadRequest || statusCode == http.StatusUnprocessableEntity:
+		return errorkind.Validation
+	}
+	return errorkind.Unknown
+}
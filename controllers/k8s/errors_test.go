@@ -0,0 +1,48 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/PayU/K8s-S3-Operator/controllers/errorkind"
+	"github.com/go-logr/logr"
+	. "github.com/onsi/gomega"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestErrorKind(t *testing.T) {
+	g := NewWithT(t)
+	serviceAccounts := schema.GroupResource{Resource: "serviceaccounts"}
+	errorKinds := []struct {
+		err  error
+		kind errorkind.Kind
+	}{
+		{apierrors.NewTooManyRequests("too many requests", 1), errorkind.Throttling},
+		{apierrors.NewConflict(serviceAccounts, "app", errors.New("object was modified")), errorkind.Transient},
+		{apierrors.NewServiceUnavailable("etcd is unavailable"), errorkind.Transient},
+		{apierrors.NewAlreadyExists(serviceAccounts, "app"), errorkind.Conflict},
+		{apierrors.NewForbidden(serviceAccounts, "app", errors.New("rbac")), errorkind.PermissionDenied},
+		{apierrors.NewBadRequest("invalid name"), errorkind.Validation},
+		{context.Canceled, errorkind.Transient},
+		{errors.New("didnt find any match pod controller"), errorkind.Unknown},
+	}
+	for _, errorKind := range errorKinds {
+		g.Expect(ErrorKind(errorKind.err)).To(Equal(errorKind.kind), errorKind.err.Error())
+	}
+}
+
+func TestAuthServerErrorKind(t *testing.T) {
+	g := NewWithT(t)
+	log := logr.Discard()
+
+	_, err := validateResponseFromAuthServer(403, "not allowed", &log)
+	g.Expect(ErrorKind(err)).To(Equal(errorkind.PermissionDenied))
+	_, err = validateResponseFromAuthServer(429, "", &log)
+	g.Expect(ErrorKind(err)).To(Equal(errorkind.Throttling))
+	_, err = validateResponseFromAuthServer(502, "", &log)
+	g.Expect(ErrorKind(err)).To(Equal(errorkind.Transient))
+	_, err = validateResponseFromAuthServer(200, "", &log)
+	g.Expect(err).NotTo(HaveOccurred())
+}
@@ -7,9 +7,19 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"time"
 
+	s3operatorv1 "github.com/PayU/K8s-S3-Operator/api/v1"
 	"github.com/PayU/K8s-S3-Operator/controllers/config"
+	"github.com/PayU/K8s-S3-Operator/controllers/dryrun"
+	"github.com/PayU/K8s-S3-Operator/controllers/errorkind"
+	"github.com/PayU/K8s-S3-Operator/controllers/metrics"
+	"github.com/PayU/K8s-S3-Operator/controllers/tracing"
 	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 	appsv1 "k8s.io/api/apps/v1"
 	batchv1 "k8s.io/api/batch/v1"
 	v1 "k8s.io/api/core/v1"
@@ -17,126 +27,204 @@ import (
 
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 type K8sClient struct {
 	client.Client
-	Log *logr.Logger
+	Recorder record.EventRecorder
 }
 
-func (k *K8sClient) HandleSACreate(serviceAcountName string, namespace string, iamRole string, s3Selector map[string]string) error {
-	k.Log.Info("starting to handle service account creation", "serviceAcount Name", serviceAcountName, "namespace", namespace, "iam_role", iamRole)
+func (k *K8sClient) HandleSACreate(ctx context.Context, s3Bucket *s3operatorv1.S3Bucket, iamRole string) (err error) {
+	log := logr.FromContextOrDiscard(ctx)
+	serviceAcountName, namespace, s3Selector := s3Bucket.Spec.Serviceaccount, s3Bucket.Namespace, s3Bucket.Spec.Selector
+	ctx, span := tracing.Tracer().Start(ctx, "HandleSACreate", trace.WithAttributes(attribute.String("service_account", serviceAcountName)))
+	defer func() { tracing.EndSpan(span, err) }()
+	status := &s3Bucket.Status
+	log.Info("starting to handle service account creation", "serviceAcount Name", serviceAcountName, "namespace", namespace, "iam_role", iamRole)
 	var podControllerType string
 	//check if SA - service account exsist
-	sa, err := k.getServiceAccount(serviceAcountName, namespace)
+	sa, err := k.getServiceAccount(ctx, serviceAcountName, namespace)
 	if err != nil {
 		return err //unexpected error in get service account function
 	}
 	if sa == nil { //service account not exists
-		sa, err = k.createServiceAccount(serviceAcountName, namespace, iamRole)
+		sa, err = k.createServiceAccount(ctx, serviceAcountName, namespace, iamRole)
 		if err == nil {
-			k.Log.Info("succseded to create new service account")
-			err = wait.ExponentialBackoff(wait.Backoff{Duration: config.WaitBackoffDuration(), Factor: config.WaitBackoffFactor(), Steps: config.WaitBackoffSteps()}, func() (done bool, err error) {
-				podControllerType, err = k.checkMatchingAppControllerToServiceAccount(serviceAcountName, s3Selector, namespace)
-				k.Log.Info("in ExponentialBackoff checkMatchingAppToServiceAccount", "WaitBackoffDuration", config.WaitBackoffDuration(), "factor", config.WaitBackoffFactor(), "steps", config.WaitBackoffSteps(), "err", err)
+			log.Info("succseded to create new service account")
+			k.Recorder.Eventf(s3Bucket, v1.EventTypeNormal, s3operatorv1.EventServiceAccountCreated,
+				"service account %s was created with iam role %s", serviceAcountName, iamRole)
+			_, waitSpan := tracing.Tracer().Start(ctx, "WaitForWorkload")
+			err = wait.ExponentialBackoffWithContext(ctx, wait.Backoff{Duration: config.WaitBackoffDuration(), Factor: config.WaitBackoffFactor(), Steps: config.WaitBackoffSteps()}, func() (done bool, err error) {
+				podControllerType, err = k.checkMatchingAppControllerToServiceAccount(ctx, serviceAcountName, s3Selector, namespace)
+				log.Info("in ExponentialBackoff checkMatchingAppToServiceAccount", "WaitBackoffDuration", config.WaitBackoffDuration(), "factor", config.WaitBackoffFactor(), "steps", config.WaitBackoffSteps(), "err", err)
 				return err == nil, err
 			})
+			tracing.EndSpan(waitSpan, err)
 			// after service account created
+			status.SetCondition(s3operatorv1.ConditionServiceAccountBound, s3Bucket.Generation, err)
 			if err != nil {
-				k.Log.Error(err, "error service account is not match to app")
-				k.deleteServiceAccount(sa)
+				log.Error(err, "error service account is not match to app")
+				k.Recorder.Eventf(s3Bucket, v1.EventTypeWarning, s3operatorv1.EventWorkloadMismatch,
+					"workload %s does not use service account %s: %v", s3Selector["app"], serviceAcountName, err)
+				k.deleteCreatedServiceAccount(ctx, sa)
 			} else { // adding to service account to auth server
 				var statuscode int
-				err = wait.ExponentialBackoff(wait.Backoff{Duration: config.WaitBackoffDuration(), Factor: config.WaitBackoffFactor(), Steps: config.WaitBackoffSteps()}, func() (done bool, err error) {
-					statuscode, err = k.addSAToAuthServer(serviceAcountName, namespace, s3Selector, podControllerType)
-					k.Log.Info("in ExponentialBackoff", "statuscode", statuscode, "err", err)
+				approveCtx, approveSpan := tracing.Tracer().Start(ctx, "WaitForAuthServerApproval")
+				err = wait.ExponentialBackoffWithContext(ctx, wait.Backoff{Duration: config.WaitBackoffDuration(), Factor: config.WaitBackoffFactor(), Steps: config.WaitBackoffSteps()}, func() (done bool, err error) {
+					statuscode, err = k.addSAToAuthServer(approveCtx, serviceAcountName, namespace, s3Selector, podControllerType)
+					log.Info("in ExponentialBackoff", "statuscode", statuscode, "err", err)
 					if statuscode == 403 {
 						return true, err
 					}
 					return err == nil, err
 				})
+				tracing.EndSpan(approveSpan, err)
+				status.SetCondition(s3operatorv1.ConditionAuthServerApproved, s3Bucket.Generation, err)
 				if err != nil { // didnt succeded to add service account to auth server
-					k.Log.Error(err, "error to add service account to auth server")
-					k.deleteServiceAccount(sa)
+					log.Error(err, "error to add service account to auth server")
+					k.Recorder.Eventf(s3Bucket, v1.EventTypeWarning, s3operatorv1.EventAuthServerRejected,
+						"service account %s was not approved by the auth server: %v", serviceAcountName, err)
+					k.deleteCreatedServiceAccount(ctx, sa)
+				} else {
+					k.Recorder.Eventf(s3Bucket, v1.EventTypeNormal, s3operatorv1.EventAuthServerApproved,
+						"service account %s was approved by the auth server", serviceAcountName)
 				}
 
 			}
 		} else {
-			k.Log.Error(err, "error to create new service account")
+			log.Error(err, "error to create new service account")
+			status.SetCondition(s3operatorv1.ConditionServiceAccountBound, s3Bucket.Generation, err)
 		}
 		return err
 
 	} else { //service accoun exsist
-		_, err = k.checkMatchingAppControllerToServiceAccount(serviceAcountName, s3Selector, namespace)
+		_, err = k.checkMatchingAppControllerToServiceAccount(ctx, serviceAcountName, s3Selector, namespace)
 		if err != nil {
-			k.Log.Error(err, "error service account is not match to app")
+			log.Error(err, "error service account is not match to app")
+			k.Recorder.Eventf(s3Bucket, v1.EventTypeWarning, s3operatorv1.EventWorkloadMismatch,
+				"workload %s does not use service account %s: %v", s3Selector["app"], serviceAcountName, err)
 		} else {
-			err = k.editServiceAccount(serviceAcountName, namespace, iamRole)
+			var isAnnotated bool
+			isAnnotated, err = k.editServiceAccount(ctx, serviceAcountName, namespace, iamRole)
+			if isAnnotated {
+				k.Recorder.Eventf(s3Bucket, v1.EventTypeNormal, s3operatorv1.EventServiceAccountAnnotated,
+					"service account %s was annotated with iam role %s", serviceAcountName, iamRole)
+			}
 		}
+		status.SetCondition(s3operatorv1.ConditionServiceAccountBound, s3Bucket.Generation, err)
+
+	}
+	return err
+}
+
+// IsSABoundToRole is true when the service account exists and is annotated with the iam role
+func (k *K8sClient) IsSABoundToRole(ctx context.Context, serviceAcountName string, namespace string, iamRole string) (bool, error) {
+	sa, err := k.getServiceAccount(ctx, serviceAcountName, namespace)
+	if err != nil || sa == nil {
+		return false, err
+	}
+	return sa.Annotations["eks.amazonaws.com/role-arn"] == iamRole, nil
+}
 
+// HandleSADeletion unbinds the iam role of a deleted bucket from its service account.
+// service account that created by the operator is deleted, otherwise only the role annotation is removed
+func (k *K8sClient) HandleSADeletion(ctx context.Context, serviceAcountName string, namespace string, iamRole string) error {
+	log := logr.FromContextOrDiscard(ctx)
+	log.Info("starting to handle service account deletion", "serviceAcount Name", serviceAcountName, "namespace", namespace, "iam_role", iamRole)
+	sa, err := k.getServiceAccount(ctx, serviceAcountName, namespace)
+	if err != nil {
+		return err
+	}
+	if sa == nil {
+		log.Info("service account not exists, nothing to cleanup")
+		return nil
+	}
+	if val, found := sa.Annotations["eks.amazonaws.com/role-arn"]; !found || val != iamRole {
+		log.Info("service account is not bound to the bucket iam role, nothing to cleanup")
+		return nil
+	}
+	defaultTag := config.DefaultTag()
+	if sa.Labels[*defaultTag.Key] == *defaultTag.Value {
+		return k.deleteServiceAccount(ctx, sa)
+	}
+	delete(sa.Annotations, "eks.amazonaws.com/role-arn")
+	err = k.Update(ctx, sa)
+	if err != nil {
+		log.Error(err, "error in update service account resource")
 	}
 	return err
 }
 
-func (k *K8sClient) getServiceAccount(serviceAcountName string, namespace string) (*v1.ServiceAccount, error) {
+func (k *K8sClient) getServiceAccount(ctx context.Context, serviceAcountName string, namespace string) (*v1.ServiceAccount, error) {
+	log := logr.FromContextOrDiscard(ctx)
 	sa := &v1.ServiceAccount{}
-	err := k.Client.Get(context.Background(), types.NamespacedName{Name: serviceAcountName, Namespace: namespace}, sa)
+	err := k.Client.Get(ctx, types.NamespacedName{Name: serviceAcountName, Namespace: namespace}, sa)
 	if err != nil {
 		if CheckIfNotFoundError(serviceAcountName, err.Error()) {
 			return nil, nil
 		} else {
-			k.Log.Error(err, "unexpcted error in Get in Reconcile function")
+			log.Error(err, "unexpcted error in Get in Reconcile function")
 			return nil, err
 		}
 	}
 	return sa, nil
 }
 
-func (k *K8sClient) createServiceAccount(serviceAcountName string, namespace string, iamRole string) (*v1.ServiceAccount, error) {
+func (k *K8sClient) createServiceAccount(ctx context.Context, serviceAcountName string, namespace string, iamRole string) (*v1.ServiceAccount, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	defaultTag := config.DefaultTag()
 	sa := &v1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: serviceAcountName,
 		Namespace:   namespace,
+		Labels:      map[string]string{*defaultTag.Key: *defaultTag.Value},
 		Annotations: map[string]string{"eks.amazonaws.com/role-arn": iamRole}}}
 
-	err := k.Create(context.Background(), sa)
+	err := k.Create(ctx, sa)
 	if err != nil {
-		k.Log.Error(err, "error in create service account resource")
+		log.Error(err, "error in create service account resource")
 		return nil, err
 	}
 	return sa, nil
 }
 
-func (k *K8sClient) editServiceAccount(serviceAcountName string, namespace string, iamRole string) error {
+func (k *K8sClient) editServiceAccount(ctx context.Context, serviceAcountName string, namespace string, iamRole string) (bool, error) {
+	log := logr.FromContextOrDiscard(ctx)
 	sa := &v1.ServiceAccount{}
-	err := k.Get(context.Background(), types.NamespacedName{Namespace: namespace, Name: serviceAcountName}, sa)
+	err := k.Get(ctx, types.NamespacedName{Namespace: namespace, Name: serviceAcountName}, sa)
 	if err != nil {
-		k.Log.Error(err, "error in get service account resource")
-		return err
+		log.Error(err, "error in get service account resource")
+		return false, err
 	}
 	if val, found := sa.Annotations["eks.amazonaws.com/role-arn"]; found {
 		if val == iamRole {
-			k.Log.Info("service account allready have this iam role", "iam_role", iamRole)
-			return nil
+			log.Info("service account allready have this iam role", "iam_role", iamRole)
+			return false, nil
 		}
-		err = errors.New("iam role annotation allready exsist, need to update role")
-		return err
+		err = errorkind.New(errorkind.Conflict, "iam role annotation allready exsist, need to update role")
+		return false, err
 	}
 
+	if sa.Annotations == nil {
+		sa.Annotations = map[string]string{}
+	}
 	sa.Annotations["eks.amazonaws.com/role-arn"] = iamRole
-	err = k.Update(context.Background(), sa)
+	err = k.Update(ctx, sa)
 	if err != nil {
-		k.Log.Error(err, "error in update service account resource")
-		return err
+		log.Error(err, "error in update service account resource")
+		return false, err
 	}
-	return nil
+	return true, nil
 }
 
-func (k *K8sClient) checkMatchingAppControllerToServiceAccount(SAName string, labelsFromS3 map[string]string, namespace string) (string, error) {
-	noMatchError := errors.New("app ServiceAccountName not match s3resource service account name")
+func (k *K8sClient) checkMatchingAppControllerToServiceAccount(ctx context.Context, SAName string, labelsFromS3 map[string]string, namespace string) (string, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	// the workload can be fixed without a change of the S3Bucket and workloads are not watched, so the mismatch is retried
+	noMatchError := errorkind.New(errorkind.Transient, "app ServiceAccountName not match s3resource service account name")
 
 	//try to find deploy
 	deploy := appsv1.Deployment{}
-	err := k.Get(context.Background(), types.NamespacedName{Namespace: namespace, Name: labelsFromS3["app"]}, &deploy)
+	err := k.Get(ctx, types.NamespacedName{Namespace: namespace, Name: labelsFromS3["app"]}, &deploy)
 	if err == nil {
 		if deploy.Spec.Template.Spec.ServiceAccountName == SAName {
 			return "Deployment", nil
@@ -145,7 +233,7 @@ func (k *K8sClient) checkMatchingAppControllerToServiceAccount(SAName string, la
 	}
 	//try to find statefull set
 	sts := appsv1.StatefulSet{}
-	err = k.Get(context.Background(), types.NamespacedName{Namespace: namespace, Name: labelsFromS3["app"]}, &sts)
+	err = k.Get(ctx, types.NamespacedName{Namespace: namespace, Name: labelsFromS3["app"]}, &sts)
 	if err == nil {
 		if sts.Spec.Template.Spec.ServiceAccountName == SAName {
 			return "StatefulSet", nil
@@ -154,7 +242,7 @@ func (k *K8sClient) checkMatchingAppControllerToServiceAccount(SAName string, la
 	}
 	//try to find job
 	job := batchv1.Job{}
-	err = k.Get(context.Background(), types.NamespacedName{Namespace: namespace, Name: labelsFromS3["app"]}, &job)
+	err = k.Get(ctx, types.NamespacedName{Namespace: namespace, Name: labelsFromS3["app"]}, &job)
 	if err == nil {
 		if job.Spec.Template.Spec.ServiceAccountName == SAName {
 			return "Job", nil
@@ -163,7 +251,7 @@ func (k *K8sClient) checkMatchingAppControllerToServiceAccount(SAName string, la
 	}
 	//try to find demonset
 	demonset := appsv1.DaemonSet{}
-	err = k.Get(context.Background(), types.NamespacedName{Namespace: namespace, Name: labelsFromS3["app"]}, &demonset)
+	err = k.Get(ctx, types.NamespacedName{Namespace: namespace, Name: labelsFromS3["app"]}, &demonset)
 	if err == nil {
 		if demonset.Spec.Template.Spec.ServiceAccountName == SAName {
 			return "DaemonSet", nil
@@ -172,109 +260,138 @@ func (k *K8sClient) checkMatchingAppControllerToServiceAccount(SAName string, la
 	}
 
 	err = errors.New("didnt find any match pod controller")
-	k.Log.Error(err, "didnt find any match pod controller", "serviceaccount_name", SAName, "labels", labelsFromS3)
+	log.Error(err, "didnt find any match pod controller", "serviceaccount_name", SAName, "labels", labelsFromS3)
 	return "", err
 }
 
-func (k *K8sClient) deleteServiceAccount(sa *v1.ServiceAccount) error {
-	k.Log.Info("Delete service account", "serviceaccount_name", sa.Name)
-	err := k.Delete(context.Background(), sa)
+func (k *K8sClient) deleteServiceAccount(ctx context.Context, sa *v1.ServiceAccount) error {
+	log := logr.FromContextOrDiscard(ctx)
+	log.Info("Delete service account", "serviceaccount_name", sa.Name)
+	err := k.Delete(ctx, sa)
 	if err != nil {
-		k.Log.Error(err, "error to delete service account", "serviceaccount_name", sa.Name)
+		log.Error(err, "error to delete service account", "serviceaccount_name", sa.Name)
 	}
 	return err
 }
 
-func (k *K8sClient) getTokenFromSA(SAName string, namespace string) (string, error) {
+// deleteCreatedServiceAccount deletes the service account that was created by a failed HandleSACreate,
+// also when the reconcile was cancelled, so the next reconcile creates it again and sends it for approval
+func (k *K8sClient) deleteCreatedServiceAccount(ctx context.Context, sa *v1.ServiceAccount) error {
+	cleanupCtx, cancel := CleanupContext(ctx)
+	defer cancel()
+	return k.deleteServiceAccount(cleanupCtx, sa)
+}
+
+func (k *K8sClient) getTokenFromSA(ctx context.Context, SAName string, namespace string) (string, error) {
+	log := logr.FromContextOrDiscard(ctx)
 	token, err := os.ReadFile(config.PathToToken())
 	if err != nil {
-		k.Log.Error(err, "error to read token", "token_path", config.PathToToken())
+		log.Error(err, "error to read token", "token_path", config.PathToToken())
 		return "", err
 	}
-	k.Log.Info("succeded to get token")
+	log.Info("succeded to get token")
 	return string(token), nil
 }
 
-func (k *K8sClient) addSAToAuthServer(SAName string, namespace string, labelsFromS3 map[string]string, podControllerType string) (int, error) {
-	k.Log.Info("starting to add service account to AC")
-	token, err := k.getTokenFromSA(SAName, namespace)
+func (k *K8sClient) addSAToAuthServer(ctx context.Context, SAName string, namespace string, labelsFromS3 map[string]string, podControllerType string) (statusCode int, err error) {
+	log := logr.FromContextOrDiscard(ctx)
+	log.Info("starting to add service account to AC")
+	ctx, span := tracing.Tracer().Start(ctx, "AuthServer POST", trace.WithSpanKind(trace.SpanKindClient))
+	defer func() {
+		span.SetAttributes(attribute.Int("http.status_code", statusCode))
+		tracing.EndSpan(span, err)
+	}()
+	if plan := dryrun.FromContext(ctx); plan != nil {
+		// the auth server approves the service account as if it was created
+		plan.Add("auth-server", "POST", config.ServiceAccountApprovalUrl()+" service account "+namespace+"/"+SAName)
+		return http.StatusOK, nil
+	}
+	token, err := k.getTokenFromSA(ctx, SAName, namespace)
 	if err != nil {
 		return 0, err
 	}
 	httpClient := http.Client{}
 
-	req, err := http.NewRequest("POST", config.ServiceAccountApprovalUrl(), k.setBody(namespace, labelsFromS3, podControllerType))
+	req, err := http.NewRequestWithContext(ctx, "POST", config.ServiceAccountApprovalUrl(), k.setBody(ctx, namespace, labelsFromS3, podControllerType))
 	if err != nil {
-		k.Log.Error(err, "error create request")
+		log.Error(err, "error create request")
 		return 0, err
 	}
 	req.Header.Add("token", token)
+	// the auth server continues the trace of the reconcile
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	startTime := time.Now()
 	res, err := httpClient.Do(req)
 	if err != nil {
-		k.Log.Error(err, "error to post request")
+		metrics.ObserveAuthServerRequest(0, time.Since(startTime))
+		log.Error(err, "error to post request")
 		return 0, err
 	}
+	metrics.ObserveAuthServerRequest(res.StatusCode, time.Since(startTime))
 
 	defer res.Body.Close()
 	resBody, err := io.ReadAll(res.Body)
 	if err != nil {
-		k.Log.Error(err, "error to read body")
+		log.Error(err, "error to read body")
 		return 0, err
 	}
-	return validateResponseFromAuthServer(res.StatusCode, string(resBody), k.Log)
+	return validateResponseFromAuthServer(res.StatusCode, string(resBody), &log)
 
 }
 
-func (k *K8sClient) setBody(namespace string, labelsFromS3 map[string]string, podControllerType string) *bytes.Reader {
+func (k *K8sClient) setBody(ctx context.Context, namespace string, labelsFromS3 map[string]string, podControllerType string) *bytes.Reader {
+	log := logr.FromContextOrDiscard(ctx)
 	// get config map that map the body of request
-	cm, err := k.getConfigMap(config.ConfigMapName(), namespace)
+	cm, err := k.getConfigMap(ctx, config.ConfigMapName(), namespace)
 	if err != nil {
-		k.Log.Error(err, "error to get config map")
+		log.Error(err, "error to get config map")
 		return nil
 	}
 
-	podController, err := k.findPodsController(namespace, labelsFromS3, podControllerType)
+	podController, err := k.findPodsController(ctx, namespace, labelsFromS3, podControllerType)
 	if err != nil {
-		k.Log.Error(err, "error to find pod controller", "podController name", labelsFromS3["app"])
+		log.Error(err, "error to find pod controller", "podController name", labelsFromS3["app"])
 		return nil
 	}
-	k.Log.Info("findPodsController", "podController", podController)
-	dataMap := cerateMapForBody(cm.Data, podController, k.Log)
+	log.Info("findPodsController", "podController", podController)
+	dataMap := cerateMapForBody(cm.Data, podController, &log)
 
-	body := convertMapToByte(dataMap, k.Log)
+	body := convertMapToByte(dataMap, &log)
 	return body
 
 }
-func (k *K8sClient) findPodsController(namespace string, labelsFromS3 map[string]string, podControllerType string) (interface{}, error) {
-	k.Log.Info("find pod controller", "podControllerType", podControllerType, "appName", labelsFromS3["app"])
+func (k *K8sClient) findPodsController(ctx context.Context, namespace string, labelsFromS3 map[string]string, podControllerType string) (interface{}, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	log.Info("find pod controller", "podControllerType", podControllerType, "appName", labelsFromS3["app"])
 	switch podControllerType {
 	case "Deployment":
 		res := appsv1.Deployment{}
-		err := k.Get(context.Background(), types.NamespacedName{Namespace: namespace, Name: labelsFromS3["app"]}, &res)
+		err := k.Get(ctx, types.NamespacedName{Namespace: namespace, Name: labelsFromS3["app"]}, &res)
 		return res, err
 	case "StatefulSet":
 		res := appsv1.StatefulSet{}
-		err := k.Get(context.Background(), types.NamespacedName{Namespace: namespace, Name: labelsFromS3["app"]}, &res)
+		err := k.Get(ctx, types.NamespacedName{Namespace: namespace, Name: labelsFromS3["app"]}, &res)
 		return res, err
 	case "Job":
 		res := batchv1.Job{}
-		err := k.Get(context.Background(), types.NamespacedName{Namespace: namespace, Name: labelsFromS3["app"]}, &res)
+		err := k.Get(ctx, types.NamespacedName{Namespace: namespace, Name: labelsFromS3["app"]}, &res)
 		return res, err
 	case "DaemonSet":
 		res := appsv1.DaemonSet{}
-		err := k.Get(context.Background(), types.NamespacedName{Namespace: namespace, Name: labelsFromS3["app"]}, &res)
+		err := k.Get(ctx, types.NamespacedName{Namespace: namespace, Name: labelsFromS3["app"]}, &res)
 		return res, err
 	default:
 		return nil, errors.New("podControllerType - " + podControllerType + " not suported")
 	}
 }
 
-func (k *K8sClient) getConfigMap(configMapName string, namespace string) (*v1.ConfigMap, error) {
-	k.Log.Info("get config map", "configMapName", configMapName)
+func (k *K8sClient) getConfigMap(ctx context.Context, configMapName string, namespace string) (*v1.ConfigMap, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	log.Info("get config map", "configMapName", configMapName)
 	cm := &v1.ConfigMap{}
-	err := k.Client.Get(context.Background(), types.NamespacedName{Name: configMapName, Namespace: namespace}, cm)
+	err := k.Client.Get(ctx, types.NamespacedName{Name: configMapName, Namespace: namespace}, cm)
 	if err != nil {
-		k.Log.Error(err, "error to get config map")
+		log.Error(err, "error to get config map")
 		return nil, err
 	}
 
@@ -0,0 +1,45 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestIsSABoundToRole(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+	roleArn := "arn:aws:iam::123456789012:role/app"
+	sa := &v1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "team-a",
+		Annotations: map[string]string{"eks.amazonaws.com/role-arn": roleArn}}}
+	k := &K8sClient{Client: fake.NewClientBuilder().WithObjects(sa).Build()}
+
+	isBound, err := k.IsSABoundToRole(ctx, "app", "team-a", roleArn)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(isBound).To(BeTrue())
+	isBound, err = k.IsSABoundToRole(ctx, "app", "team-a", "arn:aws:iam::123456789012:role/other")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(isBound).To(BeFalse())
+	isBound, err = k.IsSABoundToRole(ctx, "missing", "team-a", roleArn)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(isBound).To(BeFalse())
+}
+
+func TestEditServiceAccountWithoutAnnotations(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+	roleArn := "arn:aws:iam::123456789012:role/app"
+	sa := &v1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "team-a"}}
+	k := &K8sClient{Client: fake.NewClientBuilder().WithObjects(sa).Build()}
+
+	isAnnotated, err := k.editServiceAccount(ctx, "app", "team-a", roleArn)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(isAnnotated).To(BeTrue())
+	isBound, err := k.IsSABoundToRole(ctx, "app", "team-a", roleArn)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(isBound).To(BeTrue())
+}
@@ -2,6 +2,7 @@ package k8s
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,13 +10,16 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/PayU/K8s-S3-Operator/controllers/dryrun"
+	"github.com/PayU/K8s-S3-Operator/controllers/errorkind"
 	"github.com/go-logr/logr"
 )
 
 func validateResponseFromAuthServer(statusCode int, body string, Log *logr.Logger) (int, error) {
 	if statusCode != 200 {
-		err := errors.New("didnt succeded to add service account")
+		err := errorkind.New(authServerErrorKind(statusCode), "didnt succeded to add service account")
 		Log.Error(err, "error from auth server", "statusCode", statusCode, "body", body)
 
 		return statusCode, err
@@ -90,3 +94,16 @@ func CheckIfNotFoundError(reqName string, errStr string) bool {
 	return match
 
 }
+
+// cleanupTimeout bounds the cleanup that runs after the reconcile was cancelled
+const cleanupTimeout = 10 * time.Second
+
+// CleanupContext returns the context itself while it is active. after it was cancelled, a new short context
+// with the same logger and dry-run plan is returned, so cleanup that must not be skipped still runs
+func CleanupContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if ctx.Err() == nil {
+		return ctx, func() {}
+	}
+	cleanupCtx := dryrun.NewContext(logr.NewContext(context.Background(), logr.FromContextOrDiscard(ctx)), dryrun.FromContext(ctx))
+	return context.WithTimeout(cleanupCtx, cleanupTimeout)
+}
@@ -1,6 +1,7 @@
 package k8s
 
 import (
+	"context"
 	"os"
 	"testing"
 
@@ -49,3 +50,20 @@ func TestGetValueFuncWrongKey(t *testing.T) {
 
 }
 
+
+func TestCleanupContextOutlivesCancelledContext(t *testing.T) {
+	g := NewWithT(t)
+	ctx, cancel := context.WithCancel(logr.NewContext(context.Background(), logger))
+
+	cleanupCtx, cancelCleanup := CleanupContext(ctx)
+	g.Expect(cleanupCtx).To(Equal(ctx))
+	cancelCleanup()
+
+	cancel()
+	cleanupCtx, cancelCleanup = CleanupContext(ctx)
+	defer cancelCleanup()
+	g.Expect(cleanupCtx.Err()).NotTo(HaveOccurred())
+	_, hasDeadline := cleanupCtx.Deadline()
+	g.Expect(hasDeadline).To(BeTrue())
+	g.Expect(logr.FromContextOrDiscard(cleanupCtx)).To(Equal(logger))
+}
@@ -0,0 +1,142 @@
+package metrics
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	s3operatorv1 "github.com/PayU/K8s-S3-Operator/api/v1"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const namespace = "s3operator"
+
+// errorCodeNone is the error code label of a request that succeeded
+const errorCodeNone = "none"
+
+var (
+	awsRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "aws_requests_total",
+		Help:      "Number of aws api requests by service, operation and error code",
+	}, []string{"service", "operation", "error_code"})
+
+	awsRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "aws_request_duration_seconds",
+		Help:      "Duration of aws api requests by service and operation, retries included",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"service", "operation", "error_code"})
+
+	authServerRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "auth_server_requests_total",
+		Help:      "Number of service account approval requests to the auth server by status code",
+	}, []string{"status_code"})
+
+	authServerRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "auth_server_request_duration_seconds",
+		Help:      "Duration of service account approval requests to the auth server by status code",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"status_code"})
+
+	driftCorrectionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "drift_corrections_total",
+		Help:      "Number of bucket settings that were changed outside of the operator and corrected",
+	}, []string{"namespace", "field"})
+
+	managedBucketsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "managed_buckets"),
+		"Number of S3Bucket resources by namespace and status",
+		[]string{"namespace", "status"}, nil)
+)
+
+// Register adds the operator collectors to the registry that is served on the manager metrics endpoint,
+// the managed buckets gauge is computed from the resources in the reader on every scrape
+func Register(reader client.Reader) {
+	ctrlmetrics.Registry.MustRegister(
+		awsRequestsTotal,
+		awsRequestDuration,
+		authServerRequestsTotal,
+		authServerRequestDuration,
+		driftCorrectionsTotal,
+		&managedBucketsCollector{reader: reader},
+	)
+}
+
+// ObserveAwsRequest is a complete handler of the aws session, it is called once per api operation after its retries
+func ObserveAwsRequest(r *request.Request) {
+	errorCode := errorCodeNone
+	if r.Error != nil {
+		errorCode = "unknown"
+		if awsErr, isAwsErr := r.Error.(awserr.Error); isAwsErr {
+			errorCode = awsErr.Code()
+		}
+	}
+	operation := ""
+	if r.Operation != nil {
+		operation = r.Operation.Name
+	}
+	service := r.ClientInfo.ServiceName
+	awsRequestsTotal.WithLabelValues(service, operation, errorCode).Inc()
+	awsRequestDuration.WithLabelValues(service, operation, errorCode).Observe(time.Since(r.Time).Seconds())
+}
+
+// ObserveAuthServerRequest records a request to the auth server, statusCode is 0 when no response was received
+func ObserveAuthServerRequest(statusCode int, duration time.Duration) {
+	code := "error"
+	if statusCode != 0 {
+		code = strconv.Itoa(statusCode)
+	}
+	authServerRequestsTotal.WithLabelValues(code).Inc()
+	authServerRequestDuration.WithLabelValues(code).Observe(duration.Seconds())
+}
+
+// AddDriftCorrections counts the fields of a bucket that were corrected after a drift
+func AddDriftCorrections(bucketNamespace string, fields []string) {
+	for _, field := range fields {
+		driftCorrectionsTotal.WithLabelValues(bucketNamespace, field).Inc()
+	}
+}
+
+type managedBucketsCollector struct {
+	reader client.Reader
+}
+
+func (c *managedBucketsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- managedBucketsDesc
+}
+
+func (c *managedBucketsCollector) Collect(ch chan<- prometheus.Metric) {
+	var s3Buckets s3operatorv1.S3BucketList
+	if err := c.reader.List(context.Background(), &s3Buckets); err != nil {
+		ch <- prometheus.NewInvalidMetric(managedBucketsDesc, err)
+		return
+	}
+	for labels, count := range countBucketsByStatus(s3Buckets.Items) {
+		ch <- prometheus.MustNewConstMetric(managedBucketsDesc, prometheus.GaugeValue, float64(count), labels.namespace, labels.status)
+	}
+}
+
+type bucketLabels struct {
+	namespace string
+	status    string
+}
+
+func countBucketsByStatus(s3Buckets []s3operatorv1.S3Bucket) map[bucketLabels]int {
+	counts := map[bucketLabels]int{}
+	for _, s3Bucket := range s3Buckets {
+		status := s3Bucket.Status.Status
+		if status == "" {
+			status = "pending"
+		}
+		counts[bucketLabels{namespace: s3Bucket.Namespace, status: status}]++
+	}
+	return counts
+}
@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	s3operatorv1 "github.com/PayU/K8s-S3-Operator/api/v1"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestObserveAwsRequestLabelsErrorCode(t *testing.T) {
+	g := NewWithT(t)
+	r := &request.Request{
+		ClientInfo: metadata.ClientInfo{ServiceName: "iam"},
+		Operation:  &request.Operation{Name: "GetRole"},
+		Time:       time.Now(),
+	}
+	ObserveAwsRequest(r)
+	r.Error = awserr.New("NoSuchEntity", "role not found", nil)
+	ObserveAwsRequest(r)
+	r.Error = errors.New("connection reset")
+	ObserveAwsRequest(r)
+
+	g.Expect(testutil.ToFloat64(awsRequestsTotal.WithLabelValues("iam", "GetRole", errorCodeNone))).To(Equal(1.0))
+	g.Expect(testutil.ToFloat64(awsRequestsTotal.WithLabelValues("iam", "GetRole", "NoSuchEntity"))).To(Equal(1.0))
+	g.Expect(testutil.ToFloat64(awsRequestsTotal.WithLabelValues("iam", "GetRole", "unknown"))).To(Equal(1.0))
+}
+
+func TestObserveAuthServerRequest(t *testing.T) {
+	g := NewWithT(t)
+	ObserveAuthServerRequest(200, time.Second)
+	ObserveAuthServerRequest(0, time.Second)
+
+	g.Expect(testutil.ToFloat64(authServerRequestsTotal.WithLabelValues("200"))).To(Equal(1.0))
+	g.Expect(testutil.ToFloat64(authServerRequestsTotal.WithLabelValues("error"))).To(Equal(1.0))
+}
+
+func TestCountBucketsByStatus(t *testing.T) {
+	g := NewWithT(t)
+	s3Buckets := []s3operatorv1.S3Bucket{
+		{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "team-a"}, Status: s3operatorv1.S3BucketStatus{Status: "ready"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "team-a"}, Status: s3operatorv1.S3BucketStatus{Status: "ready"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "c", Namespace: "team-b"}},
+	}
+
+	g.Expect(countBucketsByStatus(s3Buckets)).To(Equal(map[bucketLabels]int{
+		{namespace: "team-a", status: "ready"}:   2,
+		{namespace: "team-b", status: "pending"}: 1,
+	}))
+}
@@ -18,17 +18,33 @@ package controllers
 
 import (
 	"context"
-	"time"
+	"fmt"
+	"strings"
 
 	s3operatorv1 "github.com/PayU/K8s-S3-Operator/api/v1"
 	awsClient "github.com/PayU/K8s-S3-Operator/controllers/aws"
 	"github.com/PayU/K8s-S3-Operator/controllers/config"
+	"github.com/PayU/K8s-S3-Operator/controllers/dryrun"
+	"github.com/PayU/K8s-S3-Operator/controllers/errorkind"
 	k8s "github.com/PayU/K8s-S3-Operator/controllers/k8s"
+	"github.com/PayU/K8s-S3-Operator/controllers/metrics"
+	"github.com/PayU/K8s-S3-Operator/controllers/tracing"
 
 	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 )
 
 // S3BucketReconciler reconciles a S3Bucket object
@@ -38,12 +54,15 @@ type S3BucketReconciler struct {
 	Log       *logr.Logger
 	AwsClient *awsClient.AwsClient
 	K8sClient *k8s.K8sClient
+	Recorder  record.EventRecorder
 }
 
 //+kubebuilder:rbac:groups=s3operator.payu.com,resources=s3buckets,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups="",resources=pods;configmaps;deployments,verbs=get;list;watch
 //+kubebuilder:rbac:groups="",resources=serviceaccounts,verbs=get;list;watch;create;update;patch;delete
 
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+
 //+kubebuilder:rbac:groups=apps,resources=deployments;statefulsets;daemonsets,verbs=get;list;watch
 //+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch
 
@@ -59,64 +78,106 @@ type S3BucketReconciler struct {
 //
 // For more details, check Reconcile and its Result here:
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.13.0/pkg/reconcile
-func (r *S3BucketReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+func (r *S3BucketReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Reconcile", trace.WithAttributes(
+		attribute.String("namespace", req.Namespace), attribute.String("bucket_name", req.Name)))
+	defer func() { tracing.EndSpan(span, err) }()
 	log := r.Log.WithValues("namespace", req.Namespace, "bucket_name", req.Name)
-	r.AwsClient.Log = &log
+	// the clients are shared by concurrent reconciles, they take the logger of this reconcile from the context
+	ctx = logr.NewContext(ctx, log)
 	var s3Bucket s3operatorv1.S3Bucket
 
-	errToGet := r.Get(context.TODO(), req.NamespacedName, &s3Bucket)
+	errToGet := r.Get(ctx, req.NamespacedName, &s3Bucket)
 	if errToGet != nil {
-		var err error
-		isDeleted := false
-		if k8s.CheckIfNotFoundError(req.Name, errToGet.Error()) { // check if resource not exists
-			isDeleted, err = r.handleDeleteFlow(&s3Bucket.Spec, req.Name, req.Namespace)
-		} else { //unexpcted error
-			log.Error(errToGet, "unexpcted error in Get in Reconcile function")
-			err = errToGet
+		if k8s.CheckIfNotFoundError(req.Name, errToGet.Error()) { // resource already removed, cleanup was done by the finalizer
+			log.Info("s3bucket resource not found, nothing to reconcile")
+			return ctrl.Result{Requeue: false}, nil
+		}
+		//unexpcted error
+		log.Error(errToGet, "unexpcted error in Get in Reconcile function")
+		return ctrl.Result{Requeue: true}, errToGet
+	}
+	if !s3Bucket.ObjectMeta.DeletionTimestamp.IsZero() && !dryrun.IsEnabled(&s3Bucket) { // resource is terminating, run cleanup with the real spec
+		// deleting the content of a large bucket takes longer than the reconcile timeout, so the deletion is bounded
+		// only by the timeout of each aws operation. it stops on shutdown and the next reconcile continues it
+		return r.handleFinalizer(ctx, &s3Bucket)
+	}
+	// the context is cancelled also on shutdown, every aws and kubernetes call of the reconcile stops with it
+	ctx, cancel := context.WithTimeout(ctx, config.ReconcileTimeout())
+	defer cancel()
+	if dryrun.IsEnabled(&s3Bucket) {
+		return r.handleDryRun(ctx, &s3Bucket)
+	}
+	if !controllerutil.ContainsFinalizer(&s3Bucket, config.FINALIZER_NAME) {
+		controllerutil.AddFinalizer(&s3Bucket, config.FINALIZER_NAME)
+		if err := r.Update(ctx, &s3Bucket); err != nil {
+			log.Error(err, "didnt succeded to add finalizer")
+			return ctrl.Result{Requeue: true}, err
 		}
-
-		return ctrl.Result{Requeue: !isDeleted}, err
 	}
 	//succeded to get resource, check if need to create or update
-	isbucketExists, err := r.AwsClient.IsBucketExists(s3Bucket.Name)
+	isbucketExists, err := r.AwsClient.IsBucketExists(ctx, s3Bucket.Name)
 	if err != nil {
-		r.updateBucketResourceStatus(&s3Bucket,config.STATUS_FAIL)
-		return ctrl.Result{Requeue: true}, err
+		r.updateBucketResourceStatus(ctx, &s3Bucket, config.STATUS_FAIL, err)
+		return resultForError(ctx, err)
 	}
-	if isbucketExists {
-		err = r.handleUpdateFlow(&s3Bucket.Spec, s3Bucket.Name, req.Namespace)
-	} else { //bucket not exists in aws, create
-		err = r.handleCreationFlow(&s3Bucket.Spec, s3Bucket.Name, req.Namespace)
+	if isbucketExists && s3Bucket.Status.ProvisioningStep == "" {
+		err = r.handleUpdateFlow(ctx, &s3Bucket)
+	} else { //bucket not exists in aws or its creation did not finish, create
+		err = r.handleCreationFlow(ctx, &s3Bucket)
 	}
 	if err != nil {
-		r.updateBucketResourceStatus(&s3Bucket,config.STATUS_FAIL)
-		return ctrl.Result{Requeue: true, RequeueAfter: time.Duration(10 * time.Second)}, err
+		r.updateBucketResourceStatus(ctx, &s3Bucket, config.STATUS_FAIL, err)
+		return resultForError(ctx, err)
 	}
-	r.updateBucketResourceStatus(&s3Bucket,config.STATUS_READY)
-	return ctrl.Result{Requeue: false}, err
+	r.updateBucketResourceStatus(ctx, &s3Bucket, config.STATUS_READY, nil)
+	// resync periodically, so changes that were made outside of the operator are corrected
+	return ctrl.Result{RequeueAfter: config.ResyncPeriod()}, err
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *S3BucketReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&s3operatorv1.S3Bucket{}).
+		For(&s3operatorv1.S3Bucket{}, builder.WithPredicates(s3BucketChangedPredicate())).
+		// different buckets are reconciled in parallel, the same bucket is never reconciled twice at the same time.
+		// a bucket that failed is requeued with a backoff that grows with its own failures only
+		WithOptions(controller.Options{
+			MaxConcurrentReconciles: config.MaxConcurrentReconciles(),
+			RateLimiter:             workqueue.NewItemExponentialFailureRateLimiter(config.RequeueBaseDelay(), config.RequeueMaxDelay()),
+		}).
 		Complete(r)
 }
 
-func (r *S3BucketReconciler) handleCreationFlow(bucketSpec *s3operatorv1.S3BucketSpec, bucketName string, namespace string) error {
-	err := r.AwsClient.ValidateBucketName(bucketName)
+// s3BucketChangedPredicate filters the updates of S3Bucket that need a reconcile. every reconcile writes the status
+// with a new sync time, so reconciling on status updates would requeue the bucket right after each reconcile.
+// only spec changes and deletion, which change the generation, and annotation changes, which switch dry-run, are reconciled.
+// changes that were made in aws are not watched in any case, they are corrected by the periodic resync
+func s3BucketChangedPredicate() predicate.Predicate {
+	return predicate.Or(predicate.GenerationChangedPredicate{}, predicate.AnnotationChangedPredicate{})
+}
+
+func (r *S3BucketReconciler) handleCreationFlow(ctx context.Context, s3Bucket *s3operatorv1.S3Bucket) error {
+	log := logr.FromContextOrDiscard(ctx)
+	err := r.AwsClient.ValidateBucketName(s3Bucket.Name)
 	if err != nil {
-		r.Log.Error(err, "bucket name is unvalid")
+		log.Error(err, "bucket name is unvalid")
 
 		return err
 	}
+	iamRole, err := r.AwsClient.GetRoleArn(s3Bucket)
+	if err != nil {
+		return err
+	}
 	// create or update service account
-	err = r.K8sClient.HandleSACreate(bucketSpec.Serviceaccount, namespace, awsClient.GetRoleName(bucketName), bucketSpec.Selector)
+	err = r.K8sClient.HandleSACreate(ctx, s3Bucket, iamRole)
 	if err != nil {
 		return err
 	}
+	s3Bucket.Status.ServiceAccount = s3Bucket.Spec.Serviceaccount
 
-	err = r.AwsClient.HandleBucketCreation(bucketSpec, bucketName, namespace)
+	_, span := tracing.Tracer().Start(ctx, "HandleBucketCreation")
+	err = r.AwsClient.HandleBucketCreation(ctx, s3Bucket)
+	tracing.EndSpan(span, err)
 	if err != nil {
 		return err
 	}
@@ -124,19 +185,221 @@ func (r *S3BucketReconciler) handleCreationFlow(bucketSpec *s3operatorv1.S3Bucke
 
 }
 
-func (r *S3BucketReconciler) handleUpdateFlow(bucketSpec *s3operatorv1.S3BucketSpec, bucketName string, namespace string) error {
-	err := r.AwsClient.HandleBucketUpdate(bucketName, bucketSpec)
+func (r *S3BucketReconciler) handleUpdateFlow(ctx context.Context, s3Bucket *s3operatorv1.S3Bucket) error {
+	log := logr.FromContextOrDiscard(ctx)
+	_, span := tracing.Tracer().Start(ctx, "HandleBucketUpdate")
+	driftedFields, err := r.AwsClient.HandleBucketUpdate(ctx, s3Bucket)
+	span.SetAttributes(attribute.StringSlice("drifted_fields", driftedFields))
+	tracing.EndSpan(span, err)
+	if len(driftedFields) > 0 && dryrun.FromContext(ctx) == nil {
+		metrics.AddDriftCorrections(s3Bucket.Namespace, driftedFields)
+		r.Recorder.Eventf(s3Bucket, corev1.EventTypeWarning, s3operatorv1.EventDriftCorrected,
+			"settings were changed outside of the operator and corrected: %s", strings.Join(driftedFields, ", "))
+	}
+	if err != nil {
+		return err
+	}
+	boundServiceAccount := s3Bucket.Status.ServiceAccount
+	if boundServiceAccount == s3Bucket.Spec.Serviceaccount {
+		return nil
+	}
+	iamRole, err := r.AwsClient.GetRoleArn(s3Bucket)
+	if err != nil {
+		return err
+	}
+	if boundServiceAccount == "" {
+		// buckets that were created before the binding was kept in the status are already bound, the binding is only recorded
+		isBound, err := r.K8sClient.IsSABoundToRole(ctx, s3Bucket.Spec.Serviceaccount, s3Bucket.Namespace, iamRole)
+		if err != nil {
+			return err
+		}
+		if isBound {
+			s3Bucket.Status.ServiceAccount = s3Bucket.Spec.Serviceaccount
+			return nil
+		}
+	}
+	// the trust policy was moved to the new service account, move the role annotation as well
+	log.Info("service account was changed", "old_service_account", boundServiceAccount, "service_account", s3Bucket.Spec.Serviceaccount)
+	err = r.K8sClient.HandleSACreate(ctx, s3Bucket, iamRole)
+	if err == nil && boundServiceAccount != "" {
+		err = r.K8sClient.HandleSADeletion(ctx, boundServiceAccount, s3Bucket.Namespace, iamRole)
+	}
+	if err == nil {
+		s3Bucket.Status.ServiceAccount = s3Bucket.Spec.Serviceaccount
+	}
 	return err
 }
 
-func (r *S3BucketReconciler) handleDeleteFlow(bucketSpec *s3operatorv1.S3BucketSpec, bucketName string, namespace string) (bool, error) {
-	isDelted, err := r.AwsClient.HandleBucketDeletion(bucketName)
-	return isDelted, err
+func (r *S3BucketReconciler) handleDeleteFlow(ctx context.Context, s3Bucket *s3operatorv1.S3Bucket) (bool, error) {
+	iamRole, err := r.AwsClient.GetRoleArn(s3Bucket)
+	if err != nil {
+		return false, err
+	}
+	if awsClient.IsBucketProvisioned(&s3Bucket.Status) {
+		isDeleted, err := r.AwsClient.HandleBucketDeletion(ctx, s3Bucket)
+		if err != nil || !isDeleted {
+			return isDeleted, err
+		}
+	} else {
+		// the aws calls can fail forever for a name of another account, the resource is deleted without them
+		logr.FromContextOrDiscard(ctx).Info("bucket was never provisioned by the operator, skip aws cleanup")
+	}
+	err = r.K8sClient.HandleSADeletion(ctx, s3Bucket.Spec.Serviceaccount, s3Bucket.Namespace, iamRole)
+	return err == nil, err
+}
+
+// handleFinalizer runs the deletion flow of a terminating resource and removes the
+// finalizer only after the cleanup finished, so a restart in the middle is retried
+func (r *S3BucketReconciler) handleFinalizer(ctx context.Context, s3Bucket *s3operatorv1.S3Bucket) (ctrl.Result, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	if !controllerutil.ContainsFinalizer(s3Bucket, config.FINALIZER_NAME) {
+		return ctrl.Result{Requeue: false}, nil
+	}
+	_, span := tracing.Tracer().Start(ctx, "HandleBucketDeletion")
+	isDeleted, err := r.handleDeleteFlow(ctx, s3Bucket)
+	tracing.EndSpan(span, err)
+	if err != nil {
+		log.Error(err, "didnt succeded to cleanup bucket resources, finalizer is kept")
+		r.Recorder.Eventf(s3Bucket, corev1.EventTypeWarning, s3operatorv1.EventDeletionBlocked,
+			"didnt succeded to cleanup bucket resources, finalizer is kept: %v", err)
+		r.updateBucketResourceStatus(ctx, s3Bucket, config.STATUS_FAIL, err)
+		return resultForError(ctx, err)
+	}
+	if !isDeleted {
+		log.Info("aws resources were not deleted, skip service account cleanup")
+	}
+	controllerutil.RemoveFinalizer(s3Bucket, config.FINALIZER_NAME)
+	if err = r.Update(ctx, s3Bucket); err != nil {
+		log.Error(err, "didnt succeded to remove finalizer")
+		return ctrl.Result{Requeue: true}, err
+	}
+	return ctrl.Result{Requeue: false}, nil
 }
-func (r *S3BucketReconciler)updateBucketResourceStatus( s3Bucket *s3operatorv1.S3Bucket, status string){
+
+// handleDryRun runs the flow of the bucket with a plan in the context, so every mutating call is skipped and added
+// to the plan. only the plan is written to the status, the rest of it is kept as it was before the reconcile.
+// a terminating bucket keeps its finalizer and its aws deletions are planned again on every resync, until dry-run is
+// turned off for it. only with DRY_RUN_ORPHAN_ON_DELETE the finalizer is removed, and the aws resources are orphaned
+func (r *S3BucketReconciler) handleDryRun(ctx context.Context, s3Bucket *s3operatorv1.S3Bucket) (ctrl.Result, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	reconcileCtx := ctx
+	plan := &dryrun.Plan{}
+	ctx = dryrun.NewContext(ctx, plan)
+	originalStatus := s3Bucket.Status.DeepCopy()
+	var err error
+	if !s3Bucket.ObjectMeta.DeletionTimestamp.IsZero() {
+		if controllerutil.ContainsFinalizer(s3Bucket, config.FINALIZER_NAME) {
+			_, err = r.handleDeleteFlow(ctx, s3Bucket)
+		}
+	} else {
+		var isbucketExists bool
+		isbucketExists, err = r.AwsClient.IsBucketExists(ctx, s3Bucket.Name)
+		if err == nil && isbucketExists && s3Bucket.Status.ProvisioningStep == "" {
+			err = r.handleUpdateFlow(ctx, s3Bucket)
+		} else if err == nil {
+			err = r.handleCreationFlow(ctx, s3Bucket)
+		}
+	}
+	plannedChanges := plan.Changes()
+	s3Bucket.Status = *originalStatus
+	s3Bucket.Status.PlannedChanges = plannedChanges
+	now := metav1.Now()
+	s3Bucket.Status.LastPlanTime = &now
+	plannedCondition := metav1.Condition{Type: s3operatorv1.ConditionPlanned, Status: metav1.ConditionTrue,
+		Reason: s3operatorv1.ReasonSucceeded, ObservedGeneration: s3Bucket.Generation}
+	operations := make([]string, 0, len(plannedChanges))
+	for _, change := range plannedChanges {
+		operations = append(operations, change.Service+":"+change.Operation)
+	}
+	if err != nil {
+		log.Error(err, "didnt succeded to plan the changes of the bucket")
+		plannedCondition.Status = metav1.ConditionFalse
+		plannedCondition.Reason = errorKind(err).Reason()
+		plannedCondition.Message = err.Error()
+		r.Recorder.Eventf(s3Bucket, corev1.EventTypeWarning, s3operatorv1.EventDryRunPlanned,
+			"didnt succeded to plan the changes after %s: %v", strings.Join(operations, ", "), err)
+	} else {
+		plannedCondition.Message = fmt.Sprintf("%d changes are planned and were not applied", len(plannedChanges))
+		log.Info("dry-run planned the changes of the bucket", "planned_changes", operations)
+		r.Recorder.Eventf(s3Bucket, corev1.EventTypeNormal, s3operatorv1.EventDryRunPlanned,
+			"dry-run planned %d changes: %s", len(plannedChanges), strings.Join(operations, ", "))
+	}
+	meta.SetStatusCondition(&s3Bucket.Status.Conditions, plannedCondition)
+	statusCtx, cancel := k8s.CleanupContext(ctx)
+	defer cancel()
+	if errToUpdate := r.Client.Status().Update(statusCtx, s3Bucket); errToUpdate != nil {
+		log.Error(errToUpdate, "didnt succeded to update status")
+	}
+	if err != nil {
+		return resultForError(ctx, err)
+	}
+	if !s3Bucket.ObjectMeta.DeletionTimestamp.IsZero() {
+		if !controllerutil.ContainsFinalizer(s3Bucket, config.FINALIZER_NAME) {
+			return ctrl.Result{Requeue: false}, nil
+		}
+		if !config.DryRunOrphanOnDelete() {
+			return ctrl.Result{RequeueAfter: config.ResyncPeriod()}, nil
+		}
+		log.Info("dry-run orphans the bucket and its iam role in aws, the finalizer is removed")
+		// the finalizer is removed without the plan in the context, otherwise the removal would only be planned
+		controllerutil.RemoveFinalizer(s3Bucket, config.FINALIZER_NAME)
+		if err = r.Update(reconcileCtx, s3Bucket); err != nil {
+			log.Error(err, "didnt succeded to remove finalizer")
+			return ctrl.Result{Requeue: true}, err
+		}
+		return ctrl.Result{Requeue: false}, nil
+	}
+	return ctrl.Result{RequeueAfter: config.ResyncPeriod()}, nil
+}
+
+// updateBucketResourceStatus persists the status of the reconcile together with the conditions
+// that were set by the aws and k8s clients during the flow
+func (r *S3BucketReconciler) updateBucketResourceStatus(ctx context.Context, s3Bucket *s3operatorv1.S3Bucket, status string, err error) {
+	log := logr.FromContextOrDiscard(ctx)
 	s3Bucket.Status.Status = status
-	errToUpdate := r.Client.Status().Update(context.Background(), s3Bucket)
-	if errToUpdate != nil{
-		r.Log.Error(errToUpdate,"didnt succeded to update status")
+	s3Bucket.Status.ObservedGeneration = s3Bucket.Generation
+	now := metav1.Now()
+	s3Bucket.Status.LastSyncTime = &now
+	s3Bucket.Status.LastError = ""
+	// the plan of a previous dry-run is stale once the changes are applied
+	s3Bucket.Status.PlannedChanges = nil
+	s3Bucket.Status.LastPlanTime = nil
+	meta.RemoveStatusCondition(&s3Bucket.Status.Conditions, s3operatorv1.ConditionPlanned)
+	readyCondition := metav1.Condition{Type: s3operatorv1.ConditionReady, Status: metav1.ConditionTrue,
+		Reason: s3operatorv1.ReasonSucceeded, ObservedGeneration: s3Bucket.Generation}
+	if err != nil {
+		s3Bucket.Status.LastError = err.Error()
+		readyCondition.Status = metav1.ConditionFalse
+		readyCondition.Reason = errorKind(err).Reason()
+		readyCondition.Message = err.Error()
+	}
+	meta.SetStatusCondition(&s3Bucket.Status.Conditions, readyCondition)
+	// the status is persisted also when the reconcile was cancelled, so the provisioning step is not lost
+	statusCtx, cancel := k8s.CleanupContext(ctx)
+	defer cancel()
+	errToUpdate := r.Client.Status().Update(statusCtx, s3Bucket)
+	if errToUpdate != nil {
+		log.Error(errToUpdate, "didnt succeded to update status")
 	}
-}
\ No newline at end of file
+}
+
+// errorKind classifies an error of the reconcile flow, which comes from the aws client or from the k8s client
+func errorKind(err error) errorkind.Kind {
+	if kind := awsClient.ErrorKind(err); kind != errorkind.Unknown {
+		return kind
+	}
+	return k8s.ErrorKind(err)
+}
+
+// resultForError decides how a failed reconcile is retried. a terminal failure is not retried with backoff, the bucket
+// is reconciled again when its spec changes or by the periodic resync. any other failure is returned, so the rate
+// limiter of the controller requeues the bucket with an exponential backoff
+func resultForError(ctx context.Context, err error) (ctrl.Result, error) {
+	kind := errorKind(err)
+	if kind.IsTerminal() {
+		logr.FromContextOrDiscard(ctx).Info("reconcile failed with a terminal error, the bucket is not retried until the next resync",
+			"error_kind", kind, "error", err.Error())
+		return ctrl.Result{RequeueAfter: config.ResyncPeriod()}, nil
+	}
+	return ctrl.Result{}, err
+}
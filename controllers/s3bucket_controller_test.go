@@ -0,0 +1,183 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	s3operatorv1 "github.com/PayU/K8s-S3-Operator/api/v1"
+	awsClient "github.com/PayU/K8s-S3-Operator/controllers/aws"
+	"github.com/PayU/K8s-S3-Operator/controllers/config"
+	"github.com/PayU/K8s-S3-Operator/controllers/dryrun"
+	k8s "github.com/PayU/K8s-S3-Operator/controllers/k8s"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/go-logr/logr"
+	. "github.com/onsi/gomega"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+func TestFinalizerIsRemovedOnlyAfterCleanup(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+	isAwsAvailable, isBucketDeleted := false, false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isAwsAvailable {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, "<Error><Code>ServiceUnavailable</Code><Message>service unavailable</Message></Error>")
+			return
+		}
+		query := r.URL.Query()
+		switch {
+		case r.URL.Path == "/": // iam, the role of the bucket was already deleted
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, "<ErrorResponse><Error><Code>NoSuchEntity</Code><Message>role not found</Message></Error></ErrorResponse>")
+		case query.Has("location"):
+			fmt.Fprint(w, "<LocationConstraint>eu-central-1</LocationConstraint>")
+		case query.Has("tagging"):
+			fmt.Fprint(w, "<Tagging><TagSet><Tag><Key>createdBy</Key><Value>s3Operator</Value></Tag></TagSet></Tagging>")
+		case query.Has("versions"):
+			fmt.Fprint(w, "<ListVersionsResult></ListVersionsResult>")
+		default:
+			g.Expect(r.Method).To(Equal(http.MethodDelete))
+			isBucketDeleted = true
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+	ses := session.Must(session.NewSession(&aws.Config{
+		Region:           aws.String("eu-central-1"),
+		Endpoint:         aws.String(server.URL),
+		Credentials:      credentials.AnonymousCredentials,
+		S3ForcePathStyle: aws.Bool(true),
+		MaxRetries:       aws.Int(0),
+	}))
+	scheme := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	g.Expect(s3operatorv1.AddToScheme(scheme)).To(Succeed())
+	s3Bucket := &s3operatorv1.S3Bucket{ObjectMeta: metav1.ObjectMeta{Name: "bucket", Namespace: "team-a"},
+		Spec: s3operatorv1.S3BucketSpec{Serviceaccount: "app"}}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(s3Bucket).Build()
+	logger := logr.Discard()
+	recorder := record.NewFakeRecorder(100)
+	r := &S3BucketReconciler{
+		Client: c,
+		Scheme: scheme,
+		Log:    &logger,
+		AwsClient: awsClient.NewAwsClientFromSession(&logger, ses, c, recorder,
+			awsClient.Identity{Partition: "aws", AccountId: "111122223333", OidcIssuer: "oidc.eks.eu-central-1.amazonaws.com/id/EXAMPLE"}),
+		K8sClient: &k8s.K8sClient{Client: c, Recorder: recorder},
+		Recorder:  recorder,
+	}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "bucket", Namespace: "team-a"}}
+
+	// the finalizer is added before any aws call, also when aws is unavailable
+	_, err := r.Reconcile(ctx, req)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(c.Get(ctx, req.NamespacedName, s3Bucket)).To(Succeed())
+	g.Expect(controllerutil.ContainsFinalizer(s3Bucket, config.FINALIZER_NAME)).To(BeTrue())
+
+	// the bucket was tagged by the operator, so its deletion cleans up aws
+	s3Bucket.Status.SetCondition(s3operatorv1.ConditionTaggingApplied, s3Bucket.Generation, nil)
+	g.Expect(c.Status().Update(ctx, s3Bucket)).To(Succeed())
+	g.Expect(c.Delete(ctx, s3Bucket)).To(Succeed())
+	_, err = r.Reconcile(ctx, req)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(c.Get(ctx, req.NamespacedName, s3Bucket)).To(Succeed())
+	g.Expect(controllerutil.ContainsFinalizer(s3Bucket, config.FINALIZER_NAME)).To(BeTrue())
+	g.Expect(s3Bucket.Status.Status).To(Equal(config.STATUS_FAIL))
+
+	isAwsAvailable = true
+	_, err = r.Reconcile(ctx, req)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(isBucketDeleted).To(BeTrue())
+	g.Expect(apierrors.IsNotFound(c.Get(ctx, req.NamespacedName, s3Bucket))).To(BeTrue())
+}
+
+func TestDryRunKeepsFinalizerOfTerminatingBucket(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		switch {
+		case r.URL.Path == "/": // iam, the role of the bucket was already deleted
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, "<ErrorResponse><Error><Code>NoSuchEntity</Code><Message>role not found</Message></Error></ErrorResponse>")
+		case query.Has("location"):
+			fmt.Fprint(w, "<LocationConstraint>eu-central-1</LocationConstraint>")
+		case query.Has("tagging"):
+			fmt.Fprint(w, "<Tagging><TagSet><Tag><Key>createdBy</Key><Value>s3Operator</Value></Tag></TagSet></Tagging>")
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+	}))
+	defer server.Close()
+	ses := session.Must(session.NewSession(&aws.Config{
+		Region:           aws.String("eu-central-1"),
+		Endpoint:         aws.String(server.URL),
+		Credentials:      credentials.AnonymousCredentials,
+		S3ForcePathStyle: aws.Bool(true),
+		MaxRetries:       aws.Int(0),
+	}))
+	ses.Handlers.Validate.PushBack(dryrun.SkipAwsMutation)
+	scheme := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	g.Expect(s3operatorv1.AddToScheme(scheme)).To(Succeed())
+	s3Bucket := &s3operatorv1.S3Bucket{ObjectMeta: metav1.ObjectMeta{Name: "bucket", Namespace: "team-a",
+		Annotations: map[string]string{s3operatorv1.DryRunAnnotation: "true"}, Finalizers: []string{config.FINALIZER_NAME}},
+		Spec: s3operatorv1.S3BucketSpec{Serviceaccount: "app"}}
+	s3Bucket.Status.SetCondition(s3operatorv1.ConditionTaggingApplied, s3Bucket.Generation, nil)
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(s3Bucket).Build()
+	logger := logr.Discard()
+	recorder := record.NewFakeRecorder(100)
+	r := &S3BucketReconciler{
+		Client: c,
+		Scheme: scheme,
+		Log:    &logger,
+		AwsClient: awsClient.NewAwsClientFromSession(&logger, ses, c, recorder,
+			awsClient.Identity{Partition: "aws", AccountId: "111122223333", OidcIssuer: "oidc.eks.eu-central-1.amazonaws.com/id/EXAMPLE"}),
+		K8sClient: &k8s.K8sClient{Client: c, Recorder: recorder},
+		Recorder:  recorder,
+	}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "bucket", Namespace: "team-a"}}
+	g.Expect(c.Delete(ctx, s3Bucket)).To(Succeed())
+
+	// the deletion is only planned, the finalizer keeps the bucket until dry-run is turned off for it
+	result, err := r.Reconcile(ctx, req)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result.RequeueAfter).To(Equal(config.ResyncPeriod()))
+	g.Expect(c.Get(ctx, req.NamespacedName, s3Bucket)).To(Succeed())
+	g.Expect(controllerutil.ContainsFinalizer(s3Bucket, config.FINALIZER_NAME)).To(BeTrue())
+	operations := []string{}
+	for _, change := range s3Bucket.Status.PlannedChanges {
+		operations = append(operations, change.Operation)
+	}
+	g.Expect(operations).To(Equal([]string{"DeleteObjects", "DeleteBucket"}))
+}
@@ -0,0 +1,105 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/PayU/K8s-S3-Operator/controllers/config"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/PayU/K8s-S3-Operator"
+
+// Setup registers the otlp exporter as the global tracer provider when tracing is enabled,
+// the returned function flushes the spans that were not exported yet.
+// when tracing is disabled the global no-op provider is kept, so spans cost nothing
+func Setup(Log *logr.Logger) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if !config.TracingEnabled() {
+		Log.Info("tracing is disabled")
+		return func(context.Context) error { return nil }, nil
+	}
+	options, err := exporterOptions(config.TracingEndpoint())
+	if err != nil {
+		return nil, err
+	}
+	exporter, err := otlptracehttp.New(context.Background(), options...)
+	if err != nil {
+		return nil, err
+	}
+	tracerProvider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String("k8s-s3-operator"))),
+	)
+	otel.SetTracerProvider(tracerProvider)
+	Log.Info("tracing is enabled", "endpoint", config.TracingEndpoint())
+	return tracerProvider.Shutdown, nil
+}
+
+// exporterOptions converts the endpoint url to the options of the otlp exporter,
+// an http endpoint is exported to without tls
+func exporterOptions(endpoint string) ([]otlptracehttp.Option, error) {
+	endpointUrl, err := url.Parse(endpoint)
+	if err != nil || endpointUrl.Host == "" {
+		return nil, fmt.Errorf("tracing endpoint %s is not a valid url", endpoint)
+	}
+	options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(endpointUrl.Host)}
+	if endpointUrl.Scheme == "http" {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+	if endpointUrl.Path != "" && endpointUrl.Path != "/" {
+		options = append(options, otlptracehttp.WithURLPath(endpointUrl.Path))
+	}
+	return options, nil
+}
+
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// EndSpan records the error on the span, if there is one, and ends it
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// StartAwsRequest is a validate handler of the aws session, it starts a span per api operation
+// as a child of the span in the context of the request
+func StartAwsRequest(r *request.Request) {
+	operation := ""
+	if r.Operation != nil {
+		operation = r.Operation.Name
+	}
+	ctx, _ := Tracer().Start(r.Context(), r.ClientInfo.ServiceName+"."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("rpc.system", "aws-api"),
+			attribute.String("rpc.service", r.ClientInfo.ServiceName),
+			attribute.String("rpc.method", operation),
+		))
+	r.SetContext(ctx)
+}
+
+// EndAwsRequest is a complete handler of the aws session, it ends the span of the api operation after its retries
+func EndAwsRequest(r *request.Request) {
+	span := trace.SpanFromContext(r.Context())
+	span.SetAttributes(attribute.Int("aws.retry_count", r.RetryCount))
+	if r.RequestID != "" {
+		span.SetAttributes(attribute.String("aws.request_id", r.RequestID))
+	}
+	EndSpan(span, r.Error)
+}
@@ -0,0 +1,55 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestExporterOptions(t *testing.T) {
+	g := NewWithT(t)
+
+	options, err := exporterOptions("http://otel-collector.monitoring:4318")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(options).To(HaveLen(2))
+
+	options, err = exporterOptions("https://otel-collector.monitoring:4318/custom/v1/traces")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(options).To(HaveLen(2))
+
+	_, err = exporterOptions("otel-collector:4318")
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestAwsRequestSpanIsChildOfContext(t *testing.T) {
+	g := NewWithT(t)
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	ctx, parent := Tracer().Start(context.Background(), "Reconcile")
+	r := &request.Request{
+		ClientInfo:  metadata.ClientInfo{ServiceName: "s3"},
+		Operation:   &request.Operation{Name: "CreateBucket"},
+		HTTPRequest: httptest.NewRequest("PUT", "https://bucket.s3.amazonaws.com", nil),
+	}
+	r.SetContext(ctx)
+	StartAwsRequest(r)
+	r.Error = errors.New("access denied")
+	EndAwsRequest(r)
+	parent.End()
+
+	spans := recorder.Ended()
+	g.Expect(spans).To(HaveLen(2))
+	g.Expect(spans[0].Name()).To(Equal("s3.CreateBucket"))
+	g.Expect(spans[0].Parent().SpanID()).To(Equal(parent.SpanContext().SpanID()))
+	g.Expect(spans[0].Status().Code).To(Equal(codes.Error))
+}
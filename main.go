@@ -17,6 +17,7 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
 	"os"
 	"time"
@@ -36,7 +37,10 @@ import (
 	"github.com/PayU/K8s-S3-Operator/controllers"
 	"github.com/PayU/K8s-S3-Operator/controllers/aws"
 	"github.com/PayU/K8s-S3-Operator/controllers/config"
+	"github.com/PayU/K8s-S3-Operator/controllers/dryrun"
 	k8s "github.com/PayU/K8s-S3-Operator/controllers/k8s"
+	"github.com/PayU/K8s-S3-Operator/controllers/metrics"
+	"github.com/PayU/K8s-S3-Operator/controllers/tracing"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -70,6 +74,7 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 	retryDuration := 4 * time.Second
+	gracefulShutdownTimeout := config.GracefulShutdownTimeout()
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
 		MetricsBindAddress:     metricsAddr,
@@ -78,6 +83,8 @@ func main() {
 		LeaderElection:         enableLeaderElection,
 		LeaderElectionID:       "e8727534.payu.com",
 		RetryPeriod:            &retryDuration,
+		// on SIGTERM the reconciles are cancelled, and the manager waits for them to return
+		GracefulShutdownTimeout: &gracefulShutdownTimeout,
 		// LeaderElectionReleaseOnCancel defines if the leader should step down voluntarily
 		// when the Manager ends. This requires the binary to immediately end when the
 		// Manager is stopped, otherwise, this setting is unsafe. Setting this significantly
@@ -98,12 +105,26 @@ func main() {
 		WithName("controllers").
 		WithName("s3Operator")
 
+	shutdownTracing, err := tracing.Setup(&Logger)
+	if err != nil {
+		setupLog.Error(err, "unable to set up tracing")
+		os.Exit(1)
+	}
+	metrics.Register(mgr.GetClient())
+	// the events of the lifecycle steps are not emitted for buckets in dry-run, since the steps are skipped
+	recorder := dryrun.Recorder{EventRecorder: mgr.GetEventRecorderFor("s3-operator")}
+	awsClient, err := aws.NewAwsClient(&Logger, mgr.GetClient(), recorder)
+	if err != nil {
+		setupLog.Error(err, "unable to create aws client")
+		os.Exit(1)
+	}
 	if err = (&controllers.S3BucketReconciler{
 		Client:    mgr.GetClient(),
 		Scheme:    mgr.GetScheme(),
-		AwsClient: aws.GetAwsClient(&Logger, mgr.GetClient()),
+		AwsClient: awsClient,
 		Log:       &Logger,
-		K8sClient: &k8s.K8sClient{Client: mgr.GetClient(), Log: &Logger},
+		K8sClient: &k8s.K8sClient{Client: dryrun.Client{Client: mgr.GetClient()}, Recorder: recorder},
+		Recorder:  recorder,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "S3Bucket")
 		os.Exit(1)
@@ -124,4 +145,10 @@ func main() {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
+	// export the spans that are still buffered before the operator exits
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		setupLog.Error(err, "problem shutting down tracing")
+	}
 }